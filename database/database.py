@@ -1,12 +1,91 @@
 import sqlite3
 import logging
-from datetime import datetime
+import json
+from datetime import date, datetime
 from pathlib import Path
 from typing import Dict, Any, List, Optional
+from utils.clock import Clock, SystemClock
+from utils.timestamps import to_storage, STORAGE_GLOB, BANGKOK
+from utils.notice_types import TENDER_STATUSES, ACTIVE_STATUSES, NOTICE_STATUS, CANCELLED, CLOSED
+
+class AnnouncementNotFound(LookupError):
+    """Raised when no announcement has the requested ID"""
+
+    def __init__(self, announcement_id: int):
+        super().__init__(f"Announcement {announcement_id} not found")
+        self.announcement_id = announcement_id
 
 class Database:
-    def __init__(self, db_path: str = "data/database.sqlite"):
+    # procurement_details columns stored as JSON text
+    JSON_COLUMNS = ('spec_items', 'reference_urls', 'committee')
+
+    # Columns added after the original schema; applied to existing databases on init
+    MIGRATION_COLUMNS = {
+        'announcements': {
+            'duplicate_of': 'INTEGER',
+            'notice_type': 'TEXT',
+            'original_id': 'INTEGER',
+            'status': "TEXT DEFAULT 'open'",
+            'full_title': 'TEXT',
+        },
+        'procurement_details': {
+            'spec_items': 'TEXT',
+            'page_count': 'INTEGER',
+            'failed_pages': 'INTEGER',
+            'document_sale_start': 'TEXT',
+            'document_sale_end': 'TEXT',
+            'clarification_date': 'TEXT',
+            'submission_deadline': 'TEXT',
+            'contact_address': 'TEXT',
+            'province': 'TEXT',
+            'region': 'TEXT',
+            'reference_urls': 'TEXT',
+            'raw_text': 'TEXT',
+            'bid_security': 'DECIMAL',
+            'budget_min': 'DECIMAL',
+            'budget_max': 'DECIMAL',
+            'committee': 'TEXT',
+            'signatory_name': 'TEXT',
+            'signatory_position': 'TEXT',
+            'document_sale_start_date': 'DATE',
+            'document_sale_end_date': 'DATE',
+            'delivery_location': 'TEXT',
+            'delivery_province': 'TEXT',
+            'submission_deadline_date': 'DATE',
+            'spec_text': 'TEXT',
+        },
+        'runs': {
+            'entries_filtered': 'INTEGER DEFAULT 0',
+        },
+    }
+
+    # Attempts for a write that hits a locked database, and the first wait between them in seconds
+    WRITE_ATTEMPTS = 4
+    WRITE_RETRY_DELAY = 0.1
+
+    # PRAGMA user_version from which published dates are known to be stored in UTC
+    PUBLISHED_DATES_VERSION = 1
+
+    def __init__(self, db_path: str = "data/database.sqlite", cache_size: Optional[int] = None,
+                 page_size: Optional[int] = None, clock: Optional[Clock] = None):
+        """
+        Args:
+            db_path: SQLite database file, created along with its directory when missing
+            cache_size: SQLite page cache size; pages when positive, KiB when negative,
+                SQLite's default when omitted
+            page_size: Bytes per database page, a power of two from 512 to 65536; only takes
+                effect when the database file is created
+            clock: Time source for waits between retries of a locked write, the system clock when omitted
+        """
+        if cache_size is not None and (isinstance(cache_size, bool) or not isinstance(cache_size, int)):
+            raise ValueError(f"Invalid SQLite cache size: {cache_size!r}")
+        if page_size is not None and (not isinstance(page_size, int) or not 512 <= page_size <= 65536
+                                      or page_size & (page_size - 1)):
+            raise ValueError(f"Invalid SQLite page size: {page_size!r}, expected a power of two from 512 to 65536")
         self.db_path = db_path
+        self.cache_size = cache_size
+        self.page_size = page_size
+        self.clock = clock or SystemClock()
         self.conn = None
         self.cursor = None
         
@@ -19,30 +98,95 @@ class Database:
             self.conn = sqlite3.connect(self.db_path)
             self.conn.row_factory = sqlite3.Row  # Enable row factory for named columns
             self.cursor = self.conn.cursor()
+            self.apply_pragmas()
             logging.info(f"Connected to database: {self.db_path}")
         except sqlite3.Error as e:
             logging.error(f"Error connecting to database: {e}")
             raise
 
+    def apply_pragmas(self):
+        """
+        Put the database in write-ahead log mode and apply the configured cache and page sizes
+        WAL lets readers such as the find and show commands run while a scrape or extract writes;
+        the log is checkpointed back into the database file on close
+        """
+        if self.cache_size is not None:
+            self.cursor.execute(f"PRAGMA cache_size = {self.cache_size}")
+        if self.page_size is not None:
+            # Ignored once the file has pages; it is set here before init_database creates any
+            self.cursor.execute(f"PRAGMA page_size = {self.page_size}")
+            self.cursor.execute("PRAGMA page_count")
+            if self.cursor.fetchone()[0]:
+                self.cursor.execute("PRAGMA page_size")
+                current = self.cursor.fetchone()[0]
+                if current != self.page_size:
+                    logging.warning(f"Page size {self.page_size} only applies to new databases; "
+                                    f"{self.db_path} keeps its {current}-byte pages")
+        # Switching after page_size so a new database is created with the requested pages
+        journal_mode = self.cursor.execute("PRAGMA journal_mode = WAL").fetchone()[0]
+        if journal_mode.lower() != 'wal':
+            logging.warning(f"{self.db_path} cannot use a write-ahead log, using journal mode {journal_mode}")
+
+    def execute_write(self, query: str, params=()) -> sqlite3.Cursor:
+        """
+        Execute and commit a write, retrying while another connection holds the lock
+        Raises the last sqlite3 error when the database stays locked or the write fails for another reason
+        """
+        self.retry_locked(lambda: self.cursor.execute(query, params))
+        self.retry_locked(self.conn.commit)
+        return self.cursor
+
+    def retry_locked(self, operation):
+        """
+        Run a database operation, running it again with a growing wait while the database is locked
+        A locked statement or commit leaves the connection's transaction open, so only the step that
+        hit the lock is repeated and earlier uncommitted writes are kept
+        """
+        for attempt in range(1, self.WRITE_ATTEMPTS + 1):
+            try:
+                return operation()
+            except sqlite3.OperationalError as e:
+                message = str(e).lower()
+                if ('locked' not in message and 'busy' not in message) or attempt == self.WRITE_ATTEMPTS:
+                    raise
+                delay = self.WRITE_RETRY_DELAY * 2 ** (attempt - 1)
+                logging.warning(f"Database is locked, retrying write in {delay:.1f}s "
+                                f"(attempt {attempt} of {self.WRITE_ATTEMPTS})")
+                self.clock.wait(delay)
+
     def close(self):
-        """Close database connection"""
+        """Commit pending writes, checkpoint the write-ahead log and close the database connection"""
         if self.conn:
+            try:
+                self.retry_locked(self.conn.commit)
+                # Returns (busy, log pages, checkpointed pages); -1 pages if WAL could not be enabled
+                busy, log_pages, checkpointed = self.conn.execute("PRAGMA wal_checkpoint(TRUNCATE)").fetchone()
+                logging.info(f"Database checkpoint: busy={busy}, log pages={log_pages}, checkpointed={checkpointed}")
+            except sqlite3.Error as e:
+                logging.error(f"Error checkpointing database: {e}")
             self.conn.close()
+            self.conn = None
             logging.info("Database connection closed")
 
     def init_database(self):
         """Initialize database schema"""
         try:
-            self.cursor.executescript("""
+            # Every statement is idempotent, so the whole script can run again after a lock
+            self.retry_locked(lambda: self.cursor.executescript("""
                 CREATE TABLE IF NOT EXISTS announcements (
                     id INTEGER PRIMARY KEY,
                     title TEXT NOT NULL,
+                    full_title TEXT,
                     link TEXT UNIQUE NOT NULL,
                     published_date DATE,
                     description TEXT,
                     project_id TEXT,
                     dept_id TEXT,
                     announce_type TEXT,
+                    duplicate_of INTEGER,
+                    notice_type TEXT,
+                    original_id INTEGER,
+                    status TEXT DEFAULT 'open',
                     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
                     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
                 );
@@ -60,28 +204,115 @@ class Database:
                     id INTEGER PRIMARY KEY,
                     announcement_id INTEGER,
                     budget_amount DECIMAL,
+                    budget_min DECIMAL,
+                    budget_max DECIMAL,
+                    bid_security DECIMAL,
                     quantity INTEGER,
+                    spec_items TEXT,
+                    spec_text TEXT,
                     duration_years INTEGER,
                     duration_months INTEGER,
                     submission_date DATE,
                     submission_time TIME,
+                    document_sale_start TEXT,
+                    document_sale_end TEXT,
+                    document_sale_start_date DATE,
+                    document_sale_end_date DATE,
+                    clarification_date TEXT,
+                    submission_deadline TEXT,
+                    submission_deadline_date DATE,
                     contact_phone TEXT,
                     contact_email TEXT,
+                    contact_address TEXT,
+                    province TEXT,
+                    region TEXT,
+                    delivery_location TEXT,
+                    delivery_province TEXT,
+                    reference_urls TEXT,
+                    committee TEXT,
+                    signatory_name TEXT,
+                    signatory_position TEXT,
+                    page_count INTEGER,
+                    failed_pages INTEGER,
+                    raw_text TEXT,
                     extracted_at TIMESTAMP,
                     FOREIGN KEY (announcement_id) REFERENCES announcements(id)
                 );
 
+                CREATE TABLE IF NOT EXISTS runs (
+                    id INTEGER PRIMARY KEY,
+                    command TEXT NOT NULL,
+                    status TEXT,
+                    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                    finished_at TIMESTAMP,
+                    entries_fetched INTEGER DEFAULT 0,
+                    entries_processed INTEGER DEFAULT 0,
+                    entries_skipped INTEGER DEFAULT 0,
+                    entries_deferred INTEGER DEFAULT 0,
+                    entries_filtered INTEGER DEFAULT 0,
+                    entries_failed INTEGER DEFAULT 0,
+                    bytes_downloaded INTEGER DEFAULT 0
+                );
+
+                CREATE TABLE IF NOT EXISTS dead_letter (
+                    id INTEGER PRIMARY KEY,
+                    announcement_id INTEGER UNIQUE,
+                    error TEXT,
+                    attempts INTEGER,
+                    failed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                    FOREIGN KEY (announcement_id) REFERENCES announcements(id)
+                );
+
                 -- Create indexes for better query performance
                 CREATE INDEX IF NOT EXISTS idx_announcements_link ON announcements(link);
                 CREATE INDEX IF NOT EXISTS idx_downloads_announcement_id ON downloads(announcement_id);
                 CREATE INDEX IF NOT EXISTS idx_procurement_announcement_id ON procurement_details(announcement_id);
-            """)
-            self.conn.commit()
+            """))
+            self.migrate_columns()
+            if self.user_version() < self.PUBLISHED_DATES_VERSION:
+                self.migrate_published_dates()
+                self.set_user_version(self.PUBLISHED_DATES_VERSION)
             logging.info("Database schema initialized successfully")
         except sqlite3.Error as e:
             logging.error(f"Error initializing database schema: {e}")
             raise
 
+    def migrate_columns(self):
+        """Add any columns missing from tables created by an older schema"""
+        for table, columns in self.MIGRATION_COLUMNS.items():
+            self.cursor.execute(f"PRAGMA table_info({table})")
+            existing = {row[1] for row in self.cursor.fetchall()}
+            for column, definition in columns.items():
+                if column not in existing:
+                    self.execute_write(f"ALTER TABLE {table} ADD COLUMN {column} {definition}")
+                    logging.info(f"Added column {table}.{column}")
+
+    def user_version(self) -> int:
+        """Get the schema version recorded in the database file"""
+        return self.cursor.execute("PRAGMA user_version").fetchone()[0]
+
+    def set_user_version(self, version: int):
+        """Record the schema version once a data migration has run"""
+        self.retry_locked(lambda: self.cursor.execute(f"PRAGMA user_version = {int(version)}"))
+
+    def migrate_published_dates(self):
+        """
+        Convert feed-format published dates stored before timestamps were kept in UTC
+        Runs once per database; values that cannot be parsed are left as they are
+        """
+        self.cursor.execute("SELECT id, published_date FROM announcements WHERE published_date NOT GLOB ?",
+                            (STORAGE_GLOB,))
+        converted = 0
+        for announcement_id, published_date in self.cursor.fetchall():
+            # The feed gives Bangkok times, with or without an offset
+            stored = to_storage(published_date, assume_tz=BANGKOK)
+            if stored != published_date:
+                self.execute_write("UPDATE announcements SET published_date = ? WHERE id = ?",
+                                   (stored, announcement_id))
+                converted += 1
+        if converted:
+            logging.info(f"Converted {converted} published dates to UTC")
+
     def insert_announcement(self, announcement: Dict[str, Any], dept_id: Optional[str] = None) -> Optional[int]:
         """
         Insert a new announcement into the database
@@ -104,41 +335,201 @@ class Database:
                     if len(parts) > 2:
                         announce_type = parts[2].strip()
 
-            self.cursor.execute("""
-                INSERT OR REPLACE INTO announcements (
-                    title, link, published_date, description,
-                    project_id, dept_id, announce_type,
-                    updated_at
+            # Amendments and cancellations point at the project's original announcement
+            notice_type = announcement.get('notice_type')
+            original_id = self.find_original_announcement(project_id, announcement['link']) if notice_type else None
+
+            # Upsert on the link so a re-announced entry keeps its ID and extracted details
+            self.execute_write("""
+                INSERT INTO announcements (
+                    title, full_title, link, published_date, description,
+                    project_id, dept_id, announce_type, duplicate_of,
+                    notice_type, original_id, updated_at
                 )
-                VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+                ON CONFLICT(link) DO UPDATE SET
+                    title = excluded.title,
+                    full_title = excluded.full_title,
+                    published_date = excluded.published_date,
+                    description = excluded.description,
+                    project_id = excluded.project_id,
+                    dept_id = excluded.dept_id,
+                    announce_type = excluded.announce_type,
+                    duplicate_of = excluded.duplicate_of,
+                    -- Keep a notice type detected from the document when the feed title has none
+                    notice_type = COALESCE(excluded.notice_type, announcements.notice_type),
+                    original_id = COALESCE(excluded.original_id, announcements.original_id),
+                    updated_at = CURRENT_TIMESTAMP
             """, (
                 announcement['title'],
+                announcement.get('full_title'),  # Whole title when the stored one was cut
                 announcement['link'],
-                announcement['published_date'],
+                to_storage(announcement['published_date']),  # Stored in UTC like CURRENT_TIMESTAMP
                 description,
                 project_id,
                 dept_id,  # Use the department ID from the request
-                announce_type
+                announce_type,
+                announcement.get('duplicate_of'),
+                notice_type,
+                original_id
             ))
-            self.conn.commit()
-            return self.cursor.lastrowid
+            if original_id:
+                self.apply_notice_status(original_id, notice_type)
+
+            # lastrowid is not set when the upsert updates an existing row
+            self.cursor.execute("SELECT id FROM announcements WHERE link = ?", (announcement['link'],))
+            return self.cursor.fetchone()['id']
         except sqlite3.Error as e:
             logging.error(f"Error inserting announcement: {e}")
             return None
 
+    def find_original_announcement(self, project_id: Optional[str], link: str) -> Optional[int]:
+        """Find the first ordinary announcement of a project, other than the one at link"""
+        if not project_id:
+            return None
+        try:
+            self.cursor.execute("""
+                SELECT id FROM announcements
+                WHERE project_id = ? AND link != ? AND notice_type IS NULL
+                ORDER BY id LIMIT 1
+            """, (project_id, link))
+            row = self.cursor.fetchone()
+            return row['id'] if row else None
+        except sqlite3.Error as e:
+            logging.error(f"Error finding original announcement: {e}")
+            return None
+
+    def mark_notice(self, announcement_id: int, notice_type: str) -> Optional[int]:
+        """Mark an announcement as an amendment or cancellation and link it to its original; returns the original's ID"""
+        try:
+            announcement = self.get_announcement(announcement_id)
+            original_id = self.find_original_announcement(announcement['project_id'], announcement['link'])
+            self.execute_write(
+                "UPDATE announcements SET notice_type = ?, original_id = ? WHERE id = ?",
+                (notice_type, original_id, announcement_id)
+            )
+            if original_id:
+                self.apply_notice_status(original_id, notice_type)
+            return original_id
+        except AnnouncementNotFound:
+            return None
+        except sqlite3.Error as e:
+            logging.error(f"Error marking announcement {announcement_id} as {notice_type}: {e}")
+            return None
+
+    def apply_notice_status(self, original_id: int, notice_type: str):
+        """Move an original announcement to the status an amendment or cancellation of it implies"""
+        self.set_tender_status(original_id, NOTICE_STATUS[notice_type])
+
+    def set_tender_status(self, announcement_id: int, status: str) -> bool:
+        """Set the lifecycle status of a tender; a cancelled tender keeps its status"""
+        if status not in TENDER_STATUSES:
+            logging.error(f"Unknown tender status: {status}")
+            return False
+        try:
+            self.execute_write(
+                "UPDATE announcements SET status = ? WHERE id = ? AND status IS NOT ?",
+                (status, announcement_id, CANCELLED)
+            )
+            if self.cursor.rowcount:
+                logging.info(f"Announcement {announcement_id} is now {status}")
+            return self.cursor.rowcount > 0
+        except sqlite3.Error as e:
+            logging.error(f"Error setting status of announcement {announcement_id}: {e}")
+            return False
+
+    def close_past_deadlines(self, today: date) -> int:
+        """
+        Close open and amended tenders whose bid submission deadline is before today
+        Args:
+            today: Current date in Thai time, which the deadlines are written in
+        Returns the number of tenders closed
+        """
+        try:
+            placeholders = ', '.join('?' * len(ACTIVE_STATUSES))
+            cursor = self.execute_write(f"""
+                UPDATE announcements SET status = ?
+                WHERE notice_type IS NULL AND status IN ({placeholders}) AND id IN (
+                    SELECT announcement_id FROM procurement_details WHERE submission_deadline_date < ?
+                )
+            """, (CLOSED, *ACTIVE_STATUSES, today.isoformat()))
+            if cursor.rowcount:
+                logging.info(f"Closed {cursor.rowcount} tenders past their submission deadline")
+            return cursor.rowcount
+        except sqlite3.Error as e:
+            logging.error(f"Error closing tenders past their deadline: {e}")
+            return 0
+
+    def get_active_tenders(self, dept_id: Optional[str] = None, limit: int = 10) -> List[Dict]:
+        """Get recently updated tenders that are still open (including amended ones)"""
+        try:
+            placeholders = ', '.join('?' * len(ACTIVE_STATUSES))
+            query = f"""
+                SELECT a.*, COUNT(*) OVER() as total_count
+                FROM announcements a
+                WHERE a.notice_type IS NULL AND a.status IN ({placeholders})
+            """
+            params = list(ACTIVE_STATUSES)
+            if dept_id:
+                query += " AND a.dept_id = ?"
+                params.append(dept_id)
+            query += " ORDER BY a.updated_at DESC LIMIT ?"
+            params.append(limit)
+
+            self.cursor.execute(query, params)
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting active tenders: {e}")
+            return []
+
+    def get_announcement(self, announcement_id: int) -> Dict[str, Any]:
+        """
+        Get a single announcement by ID
+        Raises AnnouncementNotFound when there is no such announcement; database errors are not caught
+        """
+        self.cursor.execute("SELECT * FROM announcements WHERE id = ?", (announcement_id,))
+        row = self.cursor.fetchone()
+        if row is None:
+            raise AnnouncementNotFound(announcement_id)
+        return dict(row)
+
     def insert_download(self, announcement_id: int, file_path: str, status: str) -> Optional[int]:
         """Insert a new download record"""
         try:
-            self.cursor.execute("""
+            self.execute_write("""
                 INSERT INTO downloads (announcement_id, file_path, download_status, download_date)
                 VALUES (?, ?, ?, CURRENT_TIMESTAMP)
             """, (announcement_id, file_path, status))
-            self.conn.commit()
             return self.cursor.lastrowid
         except sqlite3.Error as e:
             logging.error(f"Error inserting download: {e}")
             return None
 
+    def get_download_status(self, announcement_id: int) -> Optional[str]:
+        """Get the status of the most recent download record for an announcement"""
+        try:
+            self.cursor.execute(
+                "SELECT download_status FROM downloads WHERE announcement_id = ? ORDER BY id DESC LIMIT 1",
+                (announcement_id,)
+            )
+            row = self.cursor.fetchone()
+            return row['download_status'] if row else None
+        except sqlite3.Error as e:
+            logging.error(f"Error getting download status: {e}")
+            return None
+
+    def get_announcement_titles(self, dept_id: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Get the id, link and title of stored announcements for a department"""
+        try:
+            if dept_id:
+                self.cursor.execute("SELECT id, link, title FROM announcements WHERE dept_id = ?", (dept_id,))
+            else:
+                self.cursor.execute("SELECT id, link, title FROM announcements WHERE dept_id IS NULL")
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting announcement titles: {e}")
+            return []
+
     def get_pending_downloads(self) -> List[Dict[str, Any]]:
         """Get announcements that haven't been downloaded yet"""
         try:
@@ -153,6 +544,42 @@ class Database:
             logging.error(f"Error getting pending downloads: {e}")
             return []
 
+    def has_procurement_details(self, announcement_id: int) -> bool:
+        """Check whether details have already been extracted for an announcement"""
+        try:
+            self.cursor.execute(
+                "SELECT 1 FROM procurement_details WHERE announcement_id = ? LIMIT 1",
+                (announcement_id,)
+            )
+            return self.cursor.fetchone() is not None
+        except sqlite3.Error as e:
+            logging.error(f"Error checking procurement details: {e}")
+            return False
+
+    def get_procurement_details(self, announcement_id: int) -> Optional[Dict[str, Any]]:
+        """Get the most recently extracted details of an announcement, with JSON columns decoded"""
+        try:
+            self.cursor.execute(
+                "SELECT * FROM procurement_details WHERE announcement_id = ? ORDER BY id DESC LIMIT 1",
+                (announcement_id,)
+            )
+            row = self.cursor.fetchone()
+            if row is None:
+                return None
+
+            details = dict(row)
+            for column in self.JSON_COLUMNS:
+                if details.get(column):
+                    try:
+                        details[column] = json.loads(details[column])
+                    except ValueError as e:
+                        logging.warning(f"Could not decode {column} for announcement {announcement_id}: {e}")
+                        details[column] = None
+            return details
+        except sqlite3.Error as e:
+            logging.error(f"Error getting procurement details: {e}")
+            return None
+
     def get_recent_announcements(self, dept_id: Optional[str] = None, limit: int = 10) -> List[Dict]:
         """Get recent announcements with optional department filter"""
         try:
@@ -207,21 +634,218 @@ class Database:
             logging.error(f"Error getting recent announcements: {e}")
             return []
 
+    def get_announcements_by_date_range(self, start: datetime, end: datetime,
+                                        dept_id: Optional[str] = None) -> List[Dict]:
+        """
+        Get announcements published within a time range, oldest first
+        Args:
+            start: Earliest publish time (inclusive)
+            end: Latest publish time (exclusive)
+            dept_id: Only include this department when given
+        """
+        try:
+            query = """
+                SELECT * FROM announcements
+                WHERE published_date >= ? AND published_date < ?
+            """
+            params = [to_storage(start), to_storage(end)]
+            if dept_id:
+                query += " AND dept_id = ?"
+                params.append(dept_id)
+            query += " ORDER BY published_date, id"
+
+            self.cursor.execute(query, params)
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting announcements by date range: {e}")
+            return []
+
+    def get_announcements_by_budget_range(self, min_budget: float = 0, max_budget: float = 0,
+                                          limit: int = 10, offset: int = 0,
+                                          sort_desc: bool = True) -> List[Dict]:
+        """
+        Get announcements whose extracted budget falls within a range
+        Args:
+            min_budget: Lower bound in baht (inclusive)
+            max_budget: Upper bound in baht (inclusive), 0 for no upper bound
+            limit: Maximum number of rows to return
+            offset: Number of rows to skip, for paging
+            sort_desc: Sort largest budget first when True
+        """
+        try:
+            order = "DESC" if sort_desc else "ASC"
+            if max_budget:
+                where = "p.budget_amount BETWEEN ? AND ?"
+                params = (min_budget, max_budget, limit, offset)
+            else:
+                where = "p.budget_amount >= ?"
+                params = (min_budget, limit, offset)
+
+            self.cursor.execute(f"""
+                SELECT a.*, p.budget_amount, COUNT(*) OVER() as total_count
+                FROM announcements a
+                JOIN procurement_details p ON p.announcement_id = a.id
+                WHERE {where} AND a.notice_type IS NULL
+                ORDER BY p.budget_amount {order}
+                LIMIT ? OFFSET ?
+            """, params)
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting announcements by budget range: {e}")
+            return []
+
+    def get_recent_projects(self, dept_id: Optional[str] = None, limit: int = 50) -> List[Dict]:
+        """Get recently updated announcements that have extracted procurement details"""
+        try:
+            query = """
+                SELECT a.*, p.budget_amount, p.submission_date, p.submission_time,
+                       p.contact_phone, p.contact_email
+                FROM announcements a
+                JOIN procurement_details p ON p.announcement_id = a.id
+                WHERE a.notice_type IS NULL
+            """
+            params = ()
+            if dept_id:
+                query += " AND a.dept_id = ?"
+                params = (dept_id,)
+            query += " ORDER BY a.updated_at DESC LIMIT ?"
+
+            self.cursor.execute(query, params + (limit,))
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting recent projects: {e}")
+            return []
+
     def update_download_status(self, announcement_id: int, status: str):
         """Update the download status for an announcement"""
         try:
-            self.cursor.execute("""
+            self.execute_write("""
                 UPDATE downloads
                 SET download_status = ?, download_date = CURRENT_TIMESTAMP
                 WHERE announcement_id = ?
             """, (status, announcement_id))
-            self.conn.commit()
         except sqlite3.Error as e:
             logging.error(f"Error updating download status: {e}")
 
+    def start_run(self, command: str) -> Optional[int]:
+        """Record the start of a pipeline run and return its ID"""
+        try:
+            self.execute_write(
+                "INSERT INTO runs (command, status, started_at) VALUES (?, 'running', CURRENT_TIMESTAMP)",
+                (command,)
+            )
+            return self.cursor.lastrowid
+        except sqlite3.Error as e:
+            logging.error(f"Error recording run start: {e}")
+            return None
+
+    def finish_run(self, run_id: Optional[int], stats: Dict[str, int], status: str):
+        """Record the outcome and counts of a pipeline run"""
+        if run_id is None:
+            return
+        try:
+            self.execute_write("""
+                UPDATE runs
+                SET status = ?, finished_at = CURRENT_TIMESTAMP,
+                    entries_fetched = ?, entries_processed = ?, entries_skipped = ?,
+                    entries_deferred = ?, entries_filtered = ?, entries_failed = ?, bytes_downloaded = ?
+                WHERE id = ?
+            """, (
+                status,
+                stats.get('fetched', 0),
+                stats.get('processed', 0),
+                stats.get('skipped', 0),
+                stats.get('deferred', 0),
+                stats.get('filtered', 0),
+                stats.get('failed', 0),
+                stats.get('bytes_downloaded', 0),
+                run_id
+            ))
+        except sqlite3.Error as e:
+            logging.error(f"Error recording run finish: {e}")
+
+    def get_recent_runs(self, limit: int = 10) -> List[Dict]:
+        """Get the most recent pipeline runs"""
+        try:
+            self.cursor.execute("SELECT * FROM runs ORDER BY id DESC LIMIT ?", (limit,))
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting recent runs: {e}")
+            return []
+
+    def get_runs_since(self, since: datetime) -> List[Dict]:
+        """Get the pipeline runs started at or after a time, oldest first"""
+        try:
+            self.cursor.execute("SELECT * FROM runs WHERE started_at >= ? ORDER BY id", (to_storage(since),))
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting runs: {e}")
+            return []
+
+    def get_high_value_projects(self, since: datetime, min_budget: float, limit: int = 20) -> List[Dict]:
+        """Get announcements extracted at or after a time with at least the given budget, largest first"""
+        try:
+            self.cursor.execute("""
+                SELECT a.*, p.budget_amount, p.submission_date, p.submission_time, p.province
+                FROM announcements a
+                JOIN procurement_details p ON p.announcement_id = a.id
+                WHERE p.extracted_at >= ? AND p.budget_amount >= ? AND a.notice_type IS NULL
+                ORDER BY p.budget_amount DESC
+                LIMIT ?
+            """, (to_storage(since), min_budget, limit))
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting high value projects: {e}")
+            return []
+
+    def add_dead_letter(self, announcement_id: int, error: Optional[str], attempts: int):
+        """Record an announcement whose download still failed after every retry or whose processing timed out"""
+        try:
+            self.execute_write("""
+                INSERT OR REPLACE INTO dead_letter (announcement_id, error, attempts, failed_at)
+                VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+            """, (announcement_id, error, attempts))
+        except sqlite3.Error as e:
+            logging.error(f"Error recording dead letter: {e}")
+
+    def is_dead_lettered(self, announcement_id: int) -> bool:
+        """Check whether an announcement is waiting in the dead letter table"""
+        try:
+            self.cursor.execute("SELECT 1 FROM dead_letter WHERE announcement_id = ? LIMIT 1", (announcement_id,))
+            return self.cursor.fetchone() is not None
+        except sqlite3.Error as e:
+            logging.error(f"Error checking dead letter: {e}")
+            return False
+
+    def get_dead_letters(self, limit: int = 50) -> List[Dict]:
+        """Get permanently failed announcements, most recent failure first"""
+        try:
+            self.cursor.execute("""
+                SELECT d.announcement_id, d.error, d.attempts, d.failed_at,
+                       a.title, a.project_id, a.link
+                FROM dead_letter d
+                JOIN announcements a ON a.id = d.announcement_id
+                ORDER BY d.failed_at DESC, d.id DESC
+                LIMIT ?
+            """, (limit,))
+            return [dict(row) for row in self.cursor.fetchall()]
+        except sqlite3.Error as e:
+            logging.error(f"Error getting dead letters: {e}")
+            return []
+
+    def requeue_dead_letter(self, announcement_id: int) -> bool:
+        """Remove an announcement from the dead letter table so the next run retries it"""
+        try:
+            self.execute_write("DELETE FROM dead_letter WHERE announcement_id = ?", (announcement_id,))
+            return self.cursor.rowcount > 0
+        except sqlite3.Error as e:
+            logging.error(f"Error requeuing dead letter: {e}")
+            return False
+
     def __enter__(self):
         """Context manager enter"""
         self.connect()
+        self.init_database()
         return self
 
     def __exit__(self, exc_type, exc_val, exc_tb):
@@ -1,13 +1,22 @@
 import logging
+import os
 import sys
 from pathlib import Path
 import argparse
-from datetime import datetime
+from datetime import datetime, timedelta
 import codecs
-from database.database import Database
-from scripts.feed_scraper import EGPFeedScraper
+from typing import Optional
+from database.database import AnnouncementNotFound, Database
+from scripts.feed_scraper import EGPFeedScraper, DEFAULT_MAX_TITLE_LENGTH
 from utils.pdf_download import download_pdfs
-from utils.pdf_processor import process_announcements
+from utils.pdf_processor import process_announcements, reextract_announcements, reprocess_date_range
+from utils.pdf_extractor import PDFExtractor
+from utils.text_engines import ENGINES, PyPDF2Engine
+from utils.directory_extractor import extract_directory
+from utils.email_summary import build_summary, send_summary
+from utils.formatting import format_thb
+from utils.timestamps import format_display, TIMESTAMP_COLUMNS, DISPLAY_TIMEZONE
+from utils.departments import normalize_dept_id
 
 class UTFStreamHandler(logging.StreamHandler):
     def emit(self, record):
@@ -47,48 +56,288 @@ def setup_logging():
     root_logger.addHandler(console_handler)
     root_logger.addHandler(file_handler)
 
+def add_engine_argument(parser: argparse.ArgumentParser):
+    """Add the text extraction engine option shared by the commands that extract PDFs"""
+    parser.add_argument('--engine', choices=list(ENGINES), default=PyPDF2Engine.name,
+        help='PDF text extraction engine: pypdf2; pypdf2-columns, which reads two-column pages '
+             'one column at a time; or pdftotext, which needs the pdftotext program and uses '
+             'pypdf2 when it is not installed')
+
 def setup_parser() -> argparse.ArgumentParser:
     """Set up command line argument parser"""
     parser = argparse.ArgumentParser(description='EGP Procurement Data Pipeline')
+    parser.add_argument('--db-cache-size', type=int,
+        help='SQLite page cache size: pages when positive, KiB when negative (e.g. -64000 for about 64 MB)')
+    parser.add_argument('--db-page-size', type=sqlite_page_size,
+        help='SQLite page size in bytes, a power of two from 512 to 65536; only applies to a new database')
     subparsers = parser.add_subparsers(dest='command', help='Available commands')
     
     # readfeed command
     read_parser = subparsers.add_parser('readfeed', help='Read EGP RSS feed')
-    read_parser.add_argument('dept_id', nargs='?', help='4-digit department code (e.g., 0307)')
+    read_parser.add_argument('dept_id', nargs='?', type=normalize_dept_id, help='4-digit department code (e.g., 0307)')
     read_parser.add_argument('--dept-sub-id', help='10-digit sub-department code')
     read_parser.add_argument('--method-id', help='2-digit procurement method code (e.g., 16 for e-bidding)')
     read_parser.add_argument('--announce-type', help='2-character announcement type (e.g., P0 for procurement plan)')
     read_parser.add_argument('--date', help='Announcement date in YYYYMMDD format')
     read_parser.add_argument('--count', action='store_true', help='Include count of announcements per day')
+    read_parser.add_argument('--duplicate-threshold', type=float, default=0.9,
+                             help='Title similarity (0-1) for flagging likely duplicate announcements')
+    read_parser.add_argument('--backfill', action='store_true',
+                             help='One-off backfill run that ignores the access time window')
+    read_parser.add_argument('--dept-pattern', action='append', default=[], metavar='REGEX=DEPT_ID',
+                             help='Map announcement links matching REGEX to DEPT_ID when no dept_id is given (repeatable)')
+    read_parser.add_argument('--feed-url',
+                             help='Read the feed from this URL, local file or file:// URL instead of the e-GP feed')
+    read_parser.add_argument('--challenge-retries', type=int, default=0,
+                             help='Times to retry when the feed returns a Cloudflare challenge page')
+    read_parser.add_argument('--challenge-retry-delay', type=float, default=30.0,
+                             help='Seconds to wait before retrying after a challenge page')
+    read_parser.add_argument('--truncated-retries', type=int, default=2,
+                             help='Times to retry when the feed body is cut off mid-stream')
+    read_parser.add_argument('--truncated-retry-delay', type=float, default=5.0,
+                             help='Seconds to wait before retrying a cut-off feed')
+    read_parser.add_argument('--max-title-length', type=int, default=DEFAULT_MAX_TITLE_LENGTH,
+                             help='Longest title stored as-is; longer titles are cut and kept whole in full_title')
+    
+    # debugfeed command
+    debugfeed_parser = subparsers.add_parser('debugfeed', help='Print the feed items exactly as the feed returns them')
+    debugfeed_parser.add_argument('dept_id', nargs='?', type=normalize_dept_id, help='4-digit department code (e.g., 0307)')
+    debugfeed_parser.add_argument('--dept-sub-id', help='10-digit sub-department code')
+    debugfeed_parser.add_argument('--method-id', help='2-digit procurement method code (e.g., 16 for e-bidding)')
+    debugfeed_parser.add_argument('--announce-type', help='2-character announcement type (e.g., P0 for procurement plan)')
+    debugfeed_parser.add_argument('--date', help='Announcement date in YYYYMMDD format')
+    debugfeed_parser.add_argument('--backfill', action='store_true',
+                                  help='Ignore the access time window')
+    debugfeed_parser.add_argument('--feed-url',
+                                  help='Read the feed from this URL, local file or file:// URL instead of the e-GP feed')
+    debugfeed_parser.add_argument('--limit', type=int, default=10, help='Number of items to print (0 for all)')
     
     # find command
     find_parser = subparsers.add_parser('find', help='Find recent announcements')
-    find_parser.add_argument('dept_id', nargs='?', help='4-digit department code (e.g., 0307)')
+    find_parser.add_argument('dept_id', nargs='?', type=normalize_dept_id, help='4-digit department code (e.g., 0307)')
     find_parser.add_argument('limit', type=int, nargs='?', default=10, help='Number of announcements to show')
+    find_parser.add_argument('--active', action='store_true',
+                             help='Only show open or amended tenders, not cancelled, closed or notices')
+    
+    # budget command
+    budget_parser = subparsers.add_parser('budget', help='Find announcements within a budget range')
+    budget_parser.add_argument('min_budget', type=float, nargs='?', default=0, help='Minimum budget in baht')
+    budget_parser.add_argument('max_budget', type=float, nargs='?', default=0, help='Maximum budget in baht (0 for no limit)')
+    budget_parser.add_argument('--limit', type=int, default=10, help='Number of announcements to show')
+    budget_parser.add_argument('--offset', type=int, default=0, help='Number of announcements to skip')
+    budget_parser.add_argument('--asc', action='store_true', help='Show smallest budgets first')
+    
+    # runs command
+    runs_parser = subparsers.add_parser('runs', help='Show recent pipeline runs')
+    runs_parser.add_argument('limit', type=int, nargs='?', default=10, help='Number of runs to show')
+    
+    # deadletter command
+    deadletter_parser = subparsers.add_parser('deadletter', help='Show or requeue permanently failed downloads')
+    deadletter_parser.add_argument('limit', type=int, nargs='?', default=50, help='Number of entries to show')
+    deadletter_parser.add_argument('--requeue', type=int, action='append', default=[], metavar='ANNOUNCEMENT_ID',
+                                   help='Requeue an announcement so the next extract run retries it (repeatable)')
+    
+    # emailsummary command
+    email_parser = subparsers.add_parser('emailsummary',
+        help='Email a summary of recent runs and high-value projects (schedule daily with cron)')
+    email_parser.add_argument('--smtp-host', required=True, help='SMTP server host')
+    email_parser.add_argument('--smtp-port', type=int, default=587, help='SMTP server port')
+    email_parser.add_argument('--smtp-user', help='SMTP login; the password is read from $SMTP_PASSWORD')
+    email_parser.add_argument('--no-tls', action='store_true', help='Do not use STARTTLS')
+    email_parser.add_argument('--from', dest='sender', required=True, help='Sender address')
+    email_parser.add_argument('--to', dest='recipients', action='append', required=True,
+                              help='Recipient address (repeatable)')
+    email_parser.add_argument('--hours', type=float, default=24, help='Hours covered by the summary')
+    email_parser.add_argument('--min-budget', type=float, default=1_000_000,
+                              help='Smallest budget in baht for a project to be listed')
+    
+    # show command
+    show_parser = subparsers.add_parser('show', help='Show a single announcement and its extracted details')
+    show_parser.add_argument('announcement_id', type=int, help='Announcement ID')
     
     # debug command
     debug_parser = subparsers.add_parser('debug', help='Show database contents')
 
     # Add download command
     download_parser = subparsers.add_parser('download', help='Download PDFs for announcements')
-    download_parser.add_argument('dept_id', nargs='?', help='4-digit department code (e.g., 0307)')
+    download_parser.add_argument('dept_id', nargs='?', type=normalize_dept_id, help='4-digit department code (e.g., 0307)')
     download_parser.add_argument('limit', type=int, nargs='?', default=10, help='Number of announcements to process')
+    download_parser.add_argument('--max-download-mb', type=float, help='Total megabytes to download before deferring the rest')
+    download_parser.add_argument('--allow-host', action='append', default=[], help='Only download from this host (repeatable)')
+    download_parser.add_argument('--deny-host', action='append', default=[], help='Never download from this host (repeatable)')
 
     # extract command
     extract_parser = subparsers.add_parser('extract', 
         help='Download PDFs and extract data from announcements')
-    extract_parser.add_argument('dept_id', nargs='?', 
+    extract_parser.add_argument('dept_id', nargs='?', type=normalize_dept_id, 
         help='4-digit department code (e.g., 0307)')
     extract_parser.add_argument('limit', type=int, nargs='?', default=10,
         help='Number of announcements to process')
+    extract_parser.add_argument('--timeout', type=float, default=300,
+        help='Seconds allowed to download and extract each announcement')
+    extract_parser.add_argument('--max-download-mb', type=float,
+        help='Total megabytes to download before deferring the rest')
+    add_engine_argument(extract_parser)
+    extract_parser.add_argument('--force', action='store_true',
+        help='Reprocess announcements that already have extracted details')
+    extract_parser.add_argument('--min-text-length', type=int, default=100,
+        help='Fewest characters of PDF text for an extraction to count as successful')
+    extract_parser.add_argument('--output-dir',
+        help='Also write each processed announcement as <announcement_id>.json to this directory')
+    extract_parser.add_argument('--min-pages', type=int, default=0,
+        help='Fewest PDF pages for details to be stored; shorter documents are filtered (0 to disable)')
+    extract_parser.add_argument('--streaming', action='store_true',
+        help='Read PDF pages one at a time and stop once budget, duration, submission, contact, signatory '
+             'and delivery details are found; other fields only cover the pages read')
+    extract_parser.add_argument('--language', choices=['auto', 'th', 'en', 'both'], default='auto',
+        help='Extraction patterns to use; auto picks Thai and/or English from the document text')
+    extract_parser.add_argument('--store-raw-text', action='store_true',
+        help='Also store the full extracted PDF text in the database (increases its size)')
+    extract_parser.add_argument('--max-run-minutes', type=float,
+        help='Stop starting new announcements after this many minutes; the rest wait for the next run')
+    extract_parser.add_argument('--sample', type=sample_fraction, metavar='FRACTION',
+        help='Only process a random fraction (0-1) of the selected announcements, to check extraction quality')
+    extract_parser.add_argument('--seed', type=int, help='Random seed for --sample, to select the same announcements again')
+    extract_parser.add_argument('--allow-host', action='append', default=[],
+        help='Only download from this host (repeatable)')
+    extract_parser.add_argument('--deny-host', action='append', default=[],
+        help='Never download from this host (repeatable)')
+    extract_parser.add_argument('--max-in-flight-mb', type=float,
+        help='Combined size of PDFs being extracted at once, including timed-out ones still running; '
+             'further PDFs wait for room')
+
+    # reextract command
+    reextract_parser = subparsers.add_parser('reextract',
+        help='Re-extract data from already downloaded PDFs without downloading')
+    reextract_parser.add_argument('dept_id', nargs='?', type=normalize_dept_id,
+        help='4-digit department code (e.g., 0307)')
+    reextract_parser.add_argument('limit', type=int, nargs='?', default=10,
+        help='Number of announcements to process')
+    add_engine_argument(reextract_parser)
+    reextract_parser.add_argument('--min-text-length', type=int, default=100,
+        help='Fewest characters of PDF text for an extraction to count as successful')
+    reextract_parser.add_argument('--output-dir',
+        help='Also write each processed announcement as <announcement_id>.json to this directory')
+    reextract_parser.add_argument('--min-pages', type=int, default=0,
+        help='Fewest PDF pages for details to be stored; shorter documents are filtered (0 to disable)')
+    reextract_parser.add_argument('--streaming', action='store_true',
+        help='Read PDF pages one at a time and stop once budget, duration, submission, contact, signatory '
+             'and delivery details are found; other fields only cover the pages read')
+    reextract_parser.add_argument('--language', choices=['auto', 'th', 'en', 'both'], default='auto',
+        help='Extraction patterns to use; auto picks Thai and/or English from the document text')
+    reextract_parser.add_argument('--store-raw-text', action='store_true',
+        help='Also store the full extracted PDF text in the database (increases its size)')
+    reextract_parser.add_argument('--sample', type=sample_fraction, metavar='FRACTION',
+        help='Only process a random fraction (0-1) of the selected announcements, to check extraction quality')
+    reextract_parser.add_argument('--seed', type=int, help='Random seed for --sample, to select the same announcements again')
+
+    # reprocess command
+    reprocess_parser = subparsers.add_parser('reprocess',
+        help='Download and extract again all announcements published within a date range')
+    reprocess_parser.add_argument('start', type=parse_local_date, help='First publish date (YYYY-MM-DD, Bangkok time)')
+    reprocess_parser.add_argument('end', type=parse_local_date, help='Last publish date, inclusive (YYYY-MM-DD, Bangkok time)')
+    reprocess_parser.add_argument('--dept-id', type=normalize_dept_id, help='Only reprocess this department')
+    reprocess_parser.add_argument('--timeout', type=float, default=300,
+        help='Seconds allowed to download and extract each announcement')
+    reprocess_parser.add_argument('--max-download-mb', type=float,
+        help='Stop downloading new PDFs once this many megabytes have been fetched')
+    add_engine_argument(reprocess_parser)
+    reprocess_parser.add_argument('--min-text-length', type=int, default=100,
+        help='Fewest characters of extracted text for a PDF to count as successfully read')
+    reprocess_parser.add_argument('--output-dir',
+        help='Also write each processed announcement as <id>.json into this directory')
+    reprocess_parser.add_argument('--min-pages', type=int, default=0,
+        help='Fewest PDF pages for details to be stored; shorter documents are filtered (0 to disable)')
+    reprocess_parser.add_argument('--language', choices=['auto', 'th', 'en', 'both'], default='auto',
+        help='Extraction patterns to use; auto picks Thai and/or English from the document text')
+    reprocess_parser.add_argument('--store-raw-text', action='store_true',
+        help='Also store the full extracted PDF text in the database (increases its size)')
+    reprocess_parser.add_argument('--max-run-minutes', type=float,
+        help='Stop starting new announcements after this many minutes; the rest wait for the next run')
+    reprocess_parser.add_argument('--streaming', action='store_true',
+        help='Read PDF pages one at a time and stop once budget, duration, submission, contact, signatory '
+             'and delivery details are found; other fields only cover the pages read')
+    reprocess_parser.add_argument('--allow-host', action='append', default=[],
+        help='Only download from this host (repeatable)')
+    reprocess_parser.add_argument('--deny-host', action='append', default=[],
+        help='Never download from this host (repeatable)')
+    reprocess_parser.add_argument('--max-in-flight-mb', type=float,
+        help='Combined size of PDFs being extracted at once, including timed-out ones still running; '
+             'further PDFs wait for room')
+
+    # extract-dir command
+    extract_dir_parser = subparsers.add_parser('extract-dir',
+        help='Extract data from a folder of local PDFs and write the results to a file')
+    extract_dir_parser.add_argument('directory', help='Folder searched recursively for .pdf files')
+    extract_dir_parser.add_argument('--output',
+        help='Output file (default: data/exports/extract_<timestamp>.<format>)')
+    extract_dir_parser.add_argument('--format', choices=['json', 'csv'], default='json',
+        help='Output format')
+    extract_dir_parser.add_argument('--workers', type=int, default=4,
+        help='Number of PDFs extracted at the same time')
+    extract_dir_parser.add_argument('--max-in-flight-mb', type=float,
+        help='Combined size of PDFs extracted at the same time; further PDFs wait for room')
+    add_engine_argument(extract_dir_parser)
+    extract_dir_parser.add_argument('--language', choices=['auto', 'th', 'en', 'both'], default='auto',
+        help='Extraction patterns to use; auto picks Thai and/or English from the document text')
 
     return parser
 
+def megabytes_to_bytes(megabytes: Optional[float]) -> Optional[int]:
+    """Convert a megabyte command line value to bytes"""
+    return int(megabytes * 1024 * 1024) if megabytes else None
+
+def minutes_to_seconds(minutes: Optional[float]) -> Optional[float]:
+    """Convert a minutes command line value to seconds"""
+    return minutes * 60 if minutes else None
+
+def sample_fraction(value: str) -> float:
+    """Parse a --sample fraction, which must be greater than 0 and at most 1"""
+    try:
+        fraction = float(value)
+    except ValueError:
+        raise argparse.ArgumentTypeError(f"invalid fraction '{value}'")
+    if not 0 < fraction <= 1:
+        raise argparse.ArgumentTypeError(f"fraction must be greater than 0 and at most 1, got {value}")
+    return fraction
+
+def sqlite_page_size(value: str) -> int:
+    """Parse a --db-page-size, which SQLite requires to be a power of two from 512 to 65536"""
+    try:
+        page_size = int(value)
+    except ValueError:
+        raise argparse.ArgumentTypeError(f"invalid page size '{value}'")
+    if not 512 <= page_size <= 65536 or page_size & (page_size - 1):
+        raise argparse.ArgumentTypeError(f"page size must be a power of two from 512 to 65536, got {value}")
+    return page_size
+
+def parse_local_date(value: str) -> datetime:
+    """Parse a YYYY-MM-DD (or YYYYMMDD) command line date as midnight in the display time zone"""
+    for date_format in ("%Y-%m-%d", "%Y%m%d"):
+        try:
+            return datetime.strptime(value, date_format).replace(tzinfo=DISPLAY_TIMEZONE)
+        except ValueError:
+            continue
+    raise argparse.ArgumentTypeError(f"invalid date '{value}', expected YYYY-MM-DD")
+
+def database_options(args) -> dict:
+    """Database settings given on the command line"""
+    return {'cache_size': args.db_cache_size, 'page_size': args.db_page_size}
+
 def process_readfeed(args):
     """Process the readfeed command"""
     try:
-        with Database() as db:
-            scraper = EGPFeedScraper(db)
+        with Database(**database_options(args)) as db:
+            dept_patterns = dict(mapping.rsplit('=', 1) for mapping in args.dept_pattern)
+            scraper_options = {'feed_url': args.feed_url} if args.feed_url else {}
+            scraper = EGPFeedScraper(db, duplicate_threshold=args.duplicate_threshold,
+                                     dept_patterns=dept_patterns,
+                                     challenge_retries=args.challenge_retries,
+                                     challenge_retry_delay=args.challenge_retry_delay,
+                                     truncated_retries=args.truncated_retries,
+                                     truncated_retry_delay=args.truncated_retry_delay,
+                                     max_title_length=args.max_title_length,
+                                     **scraper_options)
             
             # Build parameters dict from args
             params = {
@@ -97,7 +346,8 @@ def process_readfeed(args):
                 'method_id': args.method_id,
                 'announce_type': args.announce_type,
                 'announce_date': args.date,
-                'count_by_day': args.count
+                'count_by_day': args.count,
+                'backfill': args.backfill
             }
             
             # Remove None values
@@ -119,11 +369,51 @@ def process_readfeed(args):
         logging.error(f"Error in process_readfeed: {e}")
         raise
 
+def process_debugfeed(args):
+    """Process the debugfeed command"""
+    try:
+        with Database(**database_options(args)) as db:
+            scraper_options = {'feed_url': args.feed_url} if args.feed_url else {}
+            scraper = EGPFeedScraper(db, **scraper_options)
+            params = {
+                'dept_id': args.dept_id,
+                'dept_sub_id': args.dept_sub_id,
+                'method_id': args.method_id,
+                'announce_type': args.announce_type,
+                'announce_date': args.date,
+                'backfill': args.backfill
+            }
+            items = scraper.fetch_raw_items(**{k: v for k, v in params.items() if v is not None})
+
+            if items is None:
+                print("\nCould not fetch the feed.")
+                return
+            if not items:
+                print("\nThe feed contains no items.")
+                return
+
+            shown = items[:args.limit] if args.limit else items
+            print(f"\nFeed contains {len(items)} items, showing {len(shown)}:")
+            print("=" * 100)
+            for i, item in enumerate(shown, 1):
+                print(f"\nItem {i}:")
+                for name, value in item.items():
+                    print(f"   {name}: {value!r}")
+                print("-" * 100)
+
+    except Exception as e:
+        logging.error(f"Error in process_debugfeed: {e}")
+        raise
+
 def process_find(args):
     """Process the find command"""
     try:
-        with Database() as db:
-            announcements = db.get_recent_announcements(args.dept_id, args.limit)
+        with Database(**database_options(args)) as db:
+            if args.active:
+                db.close_past_deadlines(datetime.now(DISPLAY_TIMEZONE).date())
+                announcements = db.get_active_tenders(args.dept_id, args.limit)
+            else:
+                announcements = db.get_recent_announcements(args.dept_id, args.limit)
             
             if not announcements:
                 print("\nNo announcements found in database.")
@@ -136,12 +426,15 @@ def process_find(args):
             for i, ann in enumerate(announcements, 1):
                 # Format the announcement for display
                 title = ann.get('title', '').strip()
-                published = ann.get('published_date', '').strip() if ann.get('published_date') else 'N/A'
+                published = format_display(ann.get('published_date'))
                 project_id = ann.get('project_id', 'N/A')
                 
                 print(f"\n{i}. Title: {title}")
                 print(f"   Published Date: {published}")
                 print(f"   Project ID: {project_id}")
+                print(f"   Status: {ann.get('status') or 'N/A'}"
+                      + (f" ({ann['notice_type']} of announcement {ann.get('original_id') or 'unknown'})"
+                         if ann.get('notice_type') else ""))
                 print(f"   Link: {ann.get('link', '')}")
                 print("-" * 100)
     
@@ -149,10 +442,37 @@ def process_find(args):
         logging.error(f"Error in process_find: {e}")
         raise
 
+def process_budget(args):
+    """Process the budget command"""
+    try:
+        with Database(**database_options(args)) as db:
+            announcements = db.get_announcements_by_budget_range(
+                args.min_budget, args.max_budget, args.limit, args.offset, sort_desc=not args.asc
+            )
+            
+            if not announcements:
+                print("\nNo announcements found in budget range.")
+                return
+                
+            total_count = announcements[0]['total_count']
+            print(f"\nFound {total_count} announcements in budget range, showing {len(announcements)}:")
+            print("=" * 100)
+            
+            for i, ann in enumerate(announcements, args.offset + 1):
+                print(f"\n{i}. Title: {ann.get('title', '').strip()}")
+                print(f"   Budget: {format_thb(ann['budget_amount'])}")
+                print(f"   Project ID: {ann.get('project_id', 'N/A')}")
+                print(f"   Link: {ann.get('link', '')}")
+                print("-" * 100)
+    
+    except Exception as e:
+        logging.error(f"Error in process_budget: {e}")
+        raise
+
 def process_download(args):
     """Process the download command"""
     try:
-        with Database() as db:
+        with Database(**database_options(args)) as db:
             # Get announcements
             announcements = db.get_recent_announcements(args.dept_id, args.limit)
             
@@ -163,14 +483,17 @@ def process_download(args):
             print(f"\nDownloading PDFs for {len(announcements)} announcements...")
             
             # Download PDFs
-            results = download_pdfs(announcements)
+            results = download_pdfs(announcements, max_total_bytes=megabytes_to_bytes(args.max_download_mb),
+                                    allowed_hosts=args.allow_host, denied_hosts=args.deny_host)
             
             # Print summary
             success_count = sum(1 for r in results if r['success'])
+            deferred_count = sum(1 for r in results if r['deferred'])
             print(f"\nDownload Summary:")
             print(f"Total attempted: {len(results)}")
             print(f"Successfully downloaded: {success_count}")
-            print(f"Failed: {len(results) - success_count}")
+            print(f"Deferred (download budget exhausted): {deferred_count}")
+            print(f"Failed: {len(results) - success_count - deferred_count}")
             
             # Print details
             print("\nDownload Details:")
@@ -180,6 +503,8 @@ def process_download(args):
                 print(f"   URL: {result['url']}")
                 if result['success']:
                     print(f"   Saved to: {result['filepath']}")
+                elif result['deferred']:
+                    print(f"   Deferred to next run")
                 else:
                     print(f"   Failed to download")
                     
@@ -190,16 +515,187 @@ def process_download(args):
 def process_extract(args):
     """Process the extract command"""
     try:
-        with Database() as db:
-            process_announcements(db, args.dept_id, args.limit)
+        with Database(**database_options(args)) as db:
+            process_announcements(db, args.dept_id, args.limit, entry_timeout=args.timeout,
+                                  max_download_bytes=megabytes_to_bytes(args.max_download_mb),
+                                  engine=args.engine, force=args.force,
+                                  min_text_length=args.min_text_length, output_dir=args.output_dir,
+                                  min_pages=args.min_pages, allowed_hosts=args.allow_host,
+                                  denied_hosts=args.deny_host, streaming=args.streaming,
+                                  language=args.language, store_raw_text=args.store_raw_text,
+                                  max_run_duration=minutes_to_seconds(args.max_run_minutes),
+                                  sample=args.sample, seed=args.seed,
+                                  max_in_flight_bytes=megabytes_to_bytes(args.max_in_flight_mb))
     except Exception as e:
         logging.error(f"Error in process_extract: {e}")
         raise
 
+def process_reextract(args):
+    """Process the reextract command"""
+    try:
+        with Database(**database_options(args)) as db:
+            reextract_announcements(db, args.dept_id, args.limit, engine=args.engine,
+                                    min_text_length=args.min_text_length, output_dir=args.output_dir,
+                                    min_pages=args.min_pages, streaming=args.streaming,
+                                    language=args.language, store_raw_text=args.store_raw_text,
+                                    sample=args.sample, seed=args.seed,
+                                  max_in_flight_bytes=megabytes_to_bytes(args.max_in_flight_mb))
+    except Exception as e:
+        logging.error(f"Error in process_reextract: {e}")
+        raise
+
+def process_reprocess(args):
+    """Process the reprocess command"""
+    try:
+        if args.end < args.start:
+            logging.error(f"End date {args.end:%Y-%m-%d} is before start date {args.start:%Y-%m-%d}")
+            return
+        with Database(**database_options(args)) as db:
+            reprocess_date_range(db, args.start, args.end + timedelta(days=1), args.dept_id,
+                                 entry_timeout=args.timeout,
+                                 max_download_bytes=megabytes_to_bytes(args.max_download_mb),
+                                 engine=args.engine, min_text_length=args.min_text_length,
+                                 output_dir=args.output_dir, min_pages=args.min_pages,
+                                 language=args.language, store_raw_text=args.store_raw_text,
+                                 max_run_duration=minutes_to_seconds(args.max_run_minutes),
+                                 allowed_hosts=args.allow_host, denied_hosts=args.deny_host,
+                                 streaming=args.streaming,
+                                 max_in_flight_bytes=megabytes_to_bytes(args.max_in_flight_mb))
+    except Exception as e:
+        logging.error(f"Error in process_reprocess: {e}")
+        raise
+
+def process_extract_dir(args):
+    """Process the extract-dir command"""
+    try:
+        output_file = args.output
+        if not output_file:
+            timestamp = datetime.now().strftime("%Y%m%d_%H%M%S")
+            output_file = Path("data/exports") / f"extract_{timestamp}.{args.format}"
+        extractor = PDFExtractor(engine=args.engine, language=args.language)
+        results = extract_directory(args.directory, str(output_file), args.format,
+                                    workers=args.workers, extractor=extractor,
+                                    max_in_flight_bytes=megabytes_to_bytes(args.max_in_flight_mb))
+        print(f"\nWrote {len(results)} results to {output_file}")
+    except Exception as e:
+        logging.error(f"Error in process_extract_dir: {e}")
+        raise
+
+def process_runs(args):
+    """Process the runs command"""
+    try:
+        with Database(**database_options(args)) as db:
+            runs = db.get_recent_runs(args.limit)
+            
+            if not runs:
+                print("\nNo pipeline runs recorded.")
+                return
+                
+            print(f"\nShowing {len(runs)} most recent runs:")
+            print("=" * 100)
+            
+            for run in runs:
+                print(f"\nRun {run['id']} ({run['command']}): {run['status']}")
+                print(f"   Started: {format_display(run['started_at'])}   "
+                      f"Finished: {format_display(run['finished_at'])}")
+                print(f"   Fetched: {run['entries_fetched']}   Processed: {run['entries_processed']}   "
+                      f"Skipped: {run['entries_skipped']}   Deferred: {run['entries_deferred']}   "
+                      f"Filtered: {run['entries_filtered']}   "
+                      f"Failed: {run['entries_failed']}")
+                print(f"   Downloaded: {run['bytes_downloaded'] / (1024 * 1024):.1f} MB")
+                print("-" * 100)
+    
+    except Exception as e:
+        logging.error(f"Error in process_runs: {e}")
+        raise
+
+def process_deadletter(args):
+    """Process the deadletter command"""
+    try:
+        with Database(**database_options(args)) as db:
+            if args.requeue:
+                for announcement_id in args.requeue:
+                    if db.requeue_dead_letter(announcement_id):
+                        print(f"Requeued announcement {announcement_id}")
+                    else:
+                        print(f"Announcement {announcement_id} is not in the dead letter table")
+                return
+            
+            entries = db.get_dead_letters(args.limit)
+            
+            if not entries:
+                print("\nNo permanently failed downloads.")
+                return
+                
+            print(f"\nShowing {len(entries)} permanently failed downloads:")
+            print("=" * 100)
+            
+            for entry in entries:
+                print(f"\nAnnouncement {entry['announcement_id']}: {entry.get('title', '').strip()}")
+                print(f"   Project ID: {entry.get('project_id', 'N/A')}")
+                print(f"   Error: {entry['error']} after {entry['attempts']} attempts "
+                      f"({format_display(entry['failed_at'])})")
+                print(f"   Link: {entry.get('link', '')}")
+                print("-" * 100)
+    
+    except Exception as e:
+        logging.error(f"Error in process_deadletter: {e}")
+        raise
+
+def process_emailsummary(args):
+    """Process the emailsummary command"""
+    try:
+        with Database(**database_options(args)) as db:
+            summary = build_summary(db, hours=args.hours, min_budget=args.min_budget)
+        sent = send_summary(summary, args.smtp_host, args.sender, args.recipients, port=args.smtp_port,
+                            username=args.smtp_user, password=os.environ.get('SMTP_PASSWORD'),
+                            use_tls=not args.no_tls)
+        if not sent:
+            print("\nCould not send the summary email, see the log for details.")
+    except Exception as e:
+        logging.error(f"Error in process_emailsummary: {e}")
+        raise
+
+def process_show(args):
+    """Process the show command"""
+    try:
+        with Database(**database_options(args)) as db:
+            try:
+                announcement = db.get_announcement(args.announcement_id)
+            except AnnouncementNotFound:
+                print(f"\nAnnouncement {args.announcement_id} not found.")
+                return
+
+            print(f"\nAnnouncement {announcement['id']}:")
+            print("=" * 100)
+            for key, value in announcement.items():
+                if key in TIMESTAMP_COLUMNS:
+                    value = format_display(value)
+                print(f"{key}: {value}")
+
+            details = db.get_procurement_details(announcement['id'])
+            print("\nExtracted details:")
+            print("-" * 100)
+            if not details:
+                print(f"Not extracted yet (download status: {db.get_download_status(announcement['id']) or 'N/A'})")
+                return
+            for key, value in details.items():
+                if key == 'raw_text' and value:
+                    value = f"{len(value)} characters"
+                elif key == 'budget_amount' and value is not None:
+                    value = format_thb(value)
+                elif key in TIMESTAMP_COLUMNS:
+                    value = format_display(value)
+                print(f"{key}: {value}")
+
+    except Exception as e:
+        logging.error(f"Error in process_show: {e}")
+        raise
+
 def process_debug(args):
     """Debug command to inspect database contents"""
     try:
-        with Database() as db:
+        with Database(**database_options(args)) as db:
             db.cursor.execute("SELECT title, description, link FROM announcements")
             results = db.cursor.fetchall()
             
@@ -229,12 +725,30 @@ def main():
     
     if args.command == 'readfeed':
         process_readfeed(args)
+    elif args.command == 'debugfeed':
+        process_debugfeed(args)
     elif args.command == 'find':
         process_find(args)
+    elif args.command == 'budget':
+        process_budget(args)
     elif args.command == 'download':
         process_download(args)
     elif args.command == 'extract':
         process_extract(args)
+    elif args.command == 'reextract':
+        process_reextract(args)
+    elif args.command == 'reprocess':
+        process_reprocess(args)
+    elif args.command == 'extract-dir':
+        process_extract_dir(args)
+    elif args.command == 'runs':
+        process_runs(args)
+    elif args.command == 'deadletter':
+        process_deadletter(args)
+    elif args.command == 'emailsummary':
+        process_emailsummary(args)
+    elif args.command == 'show':
+        process_show(args)
     elif args.command == 'debug':
         process_debug(args)
     else:
@@ -0,0 +1,148 @@
+import sqlite3
+import sys
+import argparse
+from pathlib import Path
+import logging
+from datetime import datetime
+from openpyxl import Workbook
+from openpyxl.styles import Font, PatternFill, Alignment
+
+HEADERS = [
+    ('ชื่อโครงการ', 60),
+    ('หน่วยงาน', 12),
+    ('เลขที่โครงการ', 16),
+    ('งบประมาณ (บาท)', 18),
+    ('ระยะเวลา', 16),
+    ('กำหนดยื่นข้อเสนอ', 24),
+    ('ติดต่อ', 30),
+    ('ลิงก์', 40),
+]
+
+def setup_logging():
+    """Configure logging"""
+    logging.basicConfig(
+        level=logging.INFO,
+        format='%(asctime)s - %(levelname)s - %(message)s',
+        handlers=[
+            logging.StreamHandler(),
+            logging.FileHandler('data/export_db.log')
+        ]
+    )
+
+def fetch_projects(conn, dept_id=None):
+    """Get announcements joined with their extracted procurement details"""
+    query = """
+        SELECT a.title, a.dept_id, a.project_id, a.link,
+               p.budget_amount, p.duration_years, p.duration_months,
+               p.submission_date, p.submission_time,
+               p.contact_phone, p.contact_email
+        FROM announcements a
+        LEFT JOIN procurement_details p ON p.announcement_id = a.id
+    """
+    params = ()
+    if dept_id:
+        query += " WHERE a.dept_id = ?"
+        params = (dept_id,)
+    query += " ORDER BY a.dept_id, p.budget_amount DESC"
+
+    cursor = conn.cursor()
+    cursor.execute(query, params)
+    return cursor.fetchall()
+
+def format_duration(years, months):
+    """Format a duration as Thai text"""
+    parts = []
+    if years:
+        parts.append(f"{years} ปี")
+    if months:
+        parts.append(f"{months} เดือน")
+    return ' '.join(parts)
+
+def write_sheet(workbook, title, rows):
+    """Write one department's projects to a styled worksheet"""
+    # Excel limits sheet names to 31 characters
+    sheet = workbook.create_sheet(title=title[:31])
+
+    header_font = Font(bold=True, color='FFFFFF')
+    header_fill = PatternFill('solid', fgColor='1F4E78')
+    for col, (name, width) in enumerate(HEADERS, 1):
+        cell = sheet.cell(row=1, column=col, value=name)
+        cell.font = header_font
+        cell.fill = header_fill
+        cell.alignment = Alignment(horizontal='center')
+        sheet.column_dimensions[cell.column_letter].width = width
+    sheet.freeze_panes = 'A2'
+
+    for row_num, row in enumerate(rows, 2):
+        submission = ' '.join(v for v in (row['submission_date'], row['submission_time']) if v)
+        contact = ', '.join(v for v in (row['contact_phone'], row['contact_email']) if v)
+        values = [
+            row['title'],
+            row['dept_id'],
+            row['project_id'],
+            row['budget_amount'],
+            format_duration(row['duration_years'], row['duration_months']),
+            submission,
+            contact,
+            row['link'],
+        ]
+        for col, value in enumerate(values, 1):
+            sheet.cell(row=row_num, column=col, value=value)
+        sheet.cell(row=row_num, column=4).number_format = '"฿"#,##0.00'
+
+def export_xlsx(conn, output_file, dept_id=None):
+    """Export projects to an Excel workbook with one sheet per department"""
+    rows = fetch_projects(conn, dept_id)
+
+    # Group rows by department, keeping query order
+    departments = {}
+    for row in rows:
+        departments.setdefault(row['dept_id'] or 'ไม่ระบุ', []).append(row)
+
+    workbook = Workbook()
+    workbook.remove(workbook.active)
+    if not departments:
+        write_sheet(workbook, 'โครงการ', [])
+    for dept, dept_rows in departments.items():
+        write_sheet(workbook, dept, dept_rows)
+
+    workbook.save(output_file)
+    logging.info(f"Exported {len(rows)} projects in {len(departments)} sheets to {output_file}")
+    return len(rows)
+
+def main():
+    """Main function to export projects to an Excel workbook"""
+    parser = argparse.ArgumentParser(description='Export projects to an Excel workbook')
+    parser.add_argument('dept_id', nargs='?', help='4-digit department code (e.g., 0307)')
+    args = parser.parse_args()
+
+    setup_logging()
+    logging.info("Starting Excel export...")
+
+    try:
+        # Setup paths
+        db_path = Path("data/database.sqlite")
+        output_dir = Path("data/exports")
+        output_dir.mkdir(parents=True, exist_ok=True)
+        timestamp = datetime.now().strftime("%Y%m%d_%H%M%S")
+        output_file = output_dir / f"projects_{timestamp}.xlsx"
+
+        # Connect to database
+        conn = sqlite3.connect(db_path)
+        conn.row_factory = sqlite3.Row
+
+        export_xlsx(conn, output_file, args.dept_id)
+        logging.info("Export completed successfully")
+
+        # Close connection
+        conn.close()
+
+    except sqlite3.Error as e:
+        logging.error(f"Database error: {e}")
+        sys.exit(1)
+    except Exception as e:
+        logging.error(f"Error during export: {e}")
+        sys.exit(1)
+
+if __name__ == "__main__":
+    main()
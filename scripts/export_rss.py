@@ -0,0 +1,98 @@
+import sys
+import argparse
+from pathlib import Path
+import logging
+from datetime import datetime, timezone
+from email.utils import format_datetime
+import xml.etree.ElementTree as ET
+
+# Add parent directory to Python path
+sys.path.append(str(Path(__file__).parent.parent))
+
+from database.database import Database
+from utils.formatting import format_thb
+from utils.departments import normalize_dept_id
+from utils.timestamps import to_display
+
+def setup_logging():
+    """Configure logging"""
+    logging.basicConfig(
+        level=logging.INFO,
+        format='%(asctime)s - %(levelname)s - %(message)s',
+        handlers=[
+            logging.StreamHandler(),
+            logging.FileHandler('data/export_db.log')
+        ]
+    )
+
+def format_pub_date(project):
+    """Format the announcement date as an RFC 822 date in Bangkok time for RSS"""
+    published = project.get('published_date')
+    if published:
+        local = to_display(published)
+        return format_datetime(local) if local else published
+
+    # Fall back to when the announcement was stored
+    return format_datetime(to_display(project['created_at']))
+
+def build_description(project):
+    """Summarize budget, deadline and contact for the item description"""
+    lines = []
+    if project.get('project_id'):
+        lines.append(f"เลขที่โครงการ: {project['project_id']}")
+    if project.get('budget_amount') is not None:
+        lines.append(f"งบประมาณ: {format_thb(project['budget_amount'])}")
+    deadline = ' '.join(v for v in (project.get('submission_date'), project.get('submission_time')) if v)
+    if deadline:
+        lines.append(f"กำหนดยื่นข้อเสนอ: {deadline}")
+    contact = ', '.join(v for v in (project.get('contact_phone'), project.get('contact_email')) if v)
+    if contact:
+        lines.append(f"ติดต่อ: {contact}")
+    return '\n'.join(lines)
+
+def build_rss(projects, title="EGP Procurement Announcements", link="http://process3.gprocurement.go.th"):
+    """Build an RSS 2.0 document from extracted projects"""
+    rss = ET.Element('rss', version='2.0')
+    channel = ET.SubElement(rss, 'channel')
+    ET.SubElement(channel, 'title').text = title
+    ET.SubElement(channel, 'link').text = link
+    ET.SubElement(channel, 'description').text = "Procurement announcements with extracted details"
+    ET.SubElement(channel, 'lastBuildDate').text = format_datetime(datetime.now(timezone.utc))
+
+    for project in projects:
+        item = ET.SubElement(channel, 'item')
+        ET.SubElement(item, 'title').text = project['title']
+        ET.SubElement(item, 'link').text = project['link']
+        ET.SubElement(item, 'guid', isPermaLink='true').text = project['link']
+        ET.SubElement(item, 'description').text = build_description(project)
+        ET.SubElement(item, 'pubDate').text = format_pub_date(project)
+
+    return ET.tostring(rss, encoding='utf-8', xml_declaration=True)
+
+def main():
+    """Main function to export recent projects as an RSS feed"""
+    parser = argparse.ArgumentParser(description='Export recent projects as an RSS 2.0 feed')
+    parser.add_argument('dept_id', nargs='?', type=normalize_dept_id, help='4-digit department code (e.g., 0307)')
+    parser.add_argument('--limit', type=int, default=50, help='Number of projects to include')
+    parser.add_argument('--output', default='data/exports/projects.xml', help='Output file path')
+    args = parser.parse_args()
+
+    setup_logging()
+    logging.info("Starting RSS export...")
+
+    try:
+        output_file = Path(args.output)
+        output_file.parent.mkdir(parents=True, exist_ok=True)
+
+        with Database() as db:
+            projects = db.get_recent_projects(args.dept_id, args.limit)
+
+        output_file.write_bytes(build_rss(projects))
+        logging.info(f"Exported {len(projects)} projects to {output_file}")
+
+    except Exception as e:
+        logging.error(f"Error during export: {e}")
+        sys.exit(1)
+
+if __name__ == "__main__":
+    main()
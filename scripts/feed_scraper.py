@@ -3,27 +3,108 @@ import sys
 from pathlib import Path
 from typing import Optional, Dict, List
 import requests
+from requests.adapters import HTTPAdapter
 import xml.etree.ElementTree as ET
+from xml.parsers import expat
+from bs4 import BeautifulSoup
 from datetime import datetime
-import time
+import re
+from urllib.parse import urlparse, parse_qs, unquote, urljoin
 
 # Add parent directory to Python path
 sys.path.append(str(Path(__file__).parent.parent))
 
 from database.database import Database
+from utils.title_similarity import title_similarity
+from utils.latency_tracker import LatencyTracker
+from utils.clock import Clock, SystemClock
+from utils.departments import normalize_dept_id
+from utils.timestamps import to_storage, BANGKOK
+from utils.notice_types import classify_notice
+
+# Department recorded when none was requested and none could be inferred
+UNKNOWN_DEPT_ID = 'unknown'
+
+# Item elements (namespace ignored) that carry the announcing department in combined feeds
+DEPT_ELEMENT_NAMES = ('deptid', 'dept_id', 'departmentid', 'department')
+
+# Longest title stored as-is; longer titles are cut and kept whole in full_title
+DEFAULT_MAX_TITLE_LENGTH = 500
+
+DEFAULT_FEED_URL = "http://process3.gprocurement.go.th/EPROCRssFeedWeb/egpannouncerss.xml"
+
+# Markers of a Cloudflare browser check page served in place of the feed
+CHALLENGE_SIGNATURES = ('cf-chl', 'cf_chl_opt', 'challenge-platform', 'cf-browser-verification',
+                        '<title>Just a moment...</title>', 'Attention Required! | Cloudflare')
+
+# Parse errors of a feed body cut off mid-stream, as opposed to a complete but malformed feed
+TRUNCATION_ERRORS = (expat.errors.codes[expat.errors.XML_ERROR_NO_ELEMENTS],
+                     expat.errors.codes[expat.errors.XML_ERROR_UNCLOSED_TOKEN],
+                     expat.errors.codes[expat.errors.XML_ERROR_UNCLOSED_CDATA_SECTION])
 
 class EGPFeedScraper:
-    def __init__(self, db: Database):
+    def __init__(self, db: Database, duplicate_threshold: float = 0.9,
+                 session: Optional[requests.Session] = None,
+                 dept_patterns: Optional[Dict[str, str]] = None,
+                 latency_tracker: Optional[LatencyTracker] = None,
+                 feed_url: str = DEFAULT_FEED_URL,
+                 clock: Optional[Clock] = None,
+                 challenge_retries: int = 0, challenge_retry_delay: float = 30.0,
+                 truncated_retries: int = 2, truncated_retry_delay: float = 5.0,
+                 max_title_length: int = DEFAULT_MAX_TITLE_LENGTH):
+        """
+        Args:
+            db: Open database connection
+            duplicate_threshold: Title similarity (0-1) at which an announcement is
+                flagged as a likely re-announcement of an existing one
+            session: HTTP session used to fetch the feed, defaults to a pooled requests.Session
+            dept_patterns: Regex patterns matched against announcement links, mapped to
+                the department ID to use when the feed was fetched without one
+            latency_tracker: Per-host latency averages to update, a new tracker when omitted
+            feed_url: Feed to read; an HTTP(S) URL, or a local path or file:// URL of a saved feed
+            clock: Time source for the access window, latency and retry waits, the system clock when omitted
+            challenge_retries: Times to fetch the feed again after getting a Cloudflare challenge page
+            challenge_retry_delay: Seconds to wait before each challenge retry
+            truncated_retries: Times to fetch the feed again after the body was cut off mid-stream
+            truncated_retry_delay: Seconds to wait before each truncated-body retry
+            max_title_length: Characters of a title stored in the title column; the whole
+                title of a longer one is kept in full_title
+        """
         self.db = db
-        self.base_url = "http://process3.gprocurement.go.th/EPROCRssFeedWeb/egpannouncerss.xml"
+        self.session = session or self.create_session()
+        self.latency_tracker = latency_tracker or LatencyTracker()
+        self.dept_patterns = [(re.compile(p), normalize_dept_id(d)) for p, d in (dept_patterns or {}).items()]
+        self.duplicate_threshold = duplicate_threshold
+        self.base_url = feed_url
+        self.clock = clock or SystemClock()
+        self.challenge_retries = challenge_retries
+        self.challenge_retry_delay = challenge_retry_delay
+        self.truncated_retries = truncated_retries
+        self.truncated_retry_delay = truncated_retry_delay
+        self.max_title_length = max_title_length
+        self.last_error = None
+        # Validators and body of the last fetch per request (department and filters), for this process only
+        self.feed_cache = {}
         
+    def create_session(self, pool_size: int = 4) -> requests.Session:
+        """
+        Create a session that keeps connections to the feed host alive between requests
+        requests only speaks HTTP/1.1, so connections are reused but there is no HTTP/2
+        """
+        session = requests.Session()
+        adapter = HTTPAdapter(pool_connections=pool_size, pool_maxsize=pool_size)
+        session.mount('http://', adapter)
+        session.mount('https://', adapter)
+        return session
+
     def fetch_feed(self, 
                   dept_id: Optional[str] = None,
                   dept_sub_id: Optional[str] = None,
                   method_id: Optional[str] = None,
                   announce_type: Optional[str] = None,
                   announce_date: Optional[str] = None,
-                  count_by_day: bool = False) -> Optional[str]:
+                  count_by_day: bool = False,
+                  backfill: bool = False) -> Optional[str]:
         """
         Fetch the e-GP RSS feed with optional parameters
         
@@ -34,8 +115,13 @@ class EGPFeedScraper:
             announce_type: 2-character announcement type (e.g., "P0" for procurement plan)
             announce_date: Date in YYYYMMDD format
             count_by_day: Whether to include count of announcements per day
+            backfill: Skip the access time window check for a one-off run
         """
+        if self.is_local_feed():
+            return self.read_feed_file()
+
         params = {}
+        dept_id = normalize_dept_id(dept_id)
         if dept_id:
             params['deptId'] = dept_id
         if dept_sub_id:
@@ -55,52 +141,201 @@ class EGPFeedScraper:
             'Accept-Language': 'en-US,en;q=0.9,th;q=0.8',
         }
 
-        # Check if current time is within allowed periods
-        current_hour = datetime.now().hour
-        current_minute = datetime.now().minute
-        
-        is_allowed_time = (
-            (12 <= current_hour < 13) or  # 12:01 - 12:59
-            (17 <= current_hour <= 23) or  # 17:01 - 23:59
-            (0 <= current_hour <= 8)       # 00:00 - 08:59
-        )
-        
-        if not is_allowed_time:
+        # Ask the server to skip the body when the feed has not changed since the last fetch
+        feed_key = tuple(sorted(params.items()))
+        cached = self.feed_cache.get(feed_key)
+        if cached:
+            if cached['etag']:
+                headers['If-None-Match'] = cached['etag']
+            if cached['last_modified']:
+                headers['If-Modified-Since'] = cached['last_modified']
+
+        if backfill:
+            logging.info("Backfill run: ignoring the access time window")
+        elif not self.is_within_allowed_time():
             logging.warning("Current time is outside the allowed access periods:")
             logging.warning("- 12:01 - 12:59")
             logging.warning("- 17:01 - 08:59")
             logging.warning("The request might fail.")
         
-        try:
-            response = requests.get(
-                self.base_url,
-                params=params,
-                headers=headers,
-                timeout=30
-            )
-            response.encoding = 'cp874'  # Set encoding to Windows-874
-            
+        challenge_attempts = 0
+        truncated_attempts = 0
+        while True:
+            try:
+                started = self.clock.monotonic()
+                response = self.session.get(
+                    self.base_url,
+                    params=params,
+                    headers=headers,
+                    timeout=30
+                )
+                self.latency_tracker.record(self.base_url, self.clock.monotonic() - started)
+                response.encoding = 'cp874'  # Set encoding to Windows-874
+            except requests.exceptions.ChunkedEncodingError as e:
+                # The connection was reset while the body was being read
+                self.last_error = f"Feed body was cut off: {e}"
+                if self.retry_truncated(truncated_attempts):
+                    truncated_attempts += 1
+                    continue
+                return None
+            except requests.exceptions.RequestException as e:
+                self.last_error = f"Error fetching feed: {e}"
+                logging.error(self.last_error)
+                return None
+
+            # Challenge pages come with 200 as well as 403/503, and would otherwise parse as an empty feed
+            if self.is_challenge_page(response):
+                self.last_error = (f"Feed request was blocked by a Cloudflare challenge page "
+                                   f"(status code {response.status_code})")
+                if challenge_attempts < self.challenge_retries:
+                    challenge_attempts += 1
+                    logging.warning(f"{self.last_error}, retrying in {self.challenge_retry_delay}s "
+                                    f"({challenge_attempts}/{self.challenge_retries})")
+                    self.clock.wait(self.challenge_retry_delay)
+                    continue
+                logging.error(f"{self.last_error}; the feed cannot be read until the challenge is cleared")
+                return None
+
+            if response.status_code == 304 and cached:
+                logging.info("Feed not modified since the last fetch, using the cached copy")
+                self.last_error = None
+                return cached['content']
+
             if response.status_code != 200:
-                logging.error(f"Failed to fetch feed. Status code: {response.status_code}")
+                self.last_error = f"Failed to fetch feed. Status code: {response.status_code}"
+                logging.error(self.last_error)
                 return None
-                
+
+            if self.is_truncated_feed(response.text):
+                self.last_error = "Feed body ended before the end of the XML document"
+                if self.retry_truncated(truncated_attempts):
+                    truncated_attempts += 1
+                    continue
+                return None
+
+            self.last_error = None
+            etag = response.headers.get('ETag')
+            last_modified = response.headers.get('Last-Modified')
+            if etag or last_modified:
+                self.feed_cache[feed_key] = {'etag': etag, 'last_modified': last_modified, 'content': response.text}
+            else:
+                self.feed_cache.pop(feed_key, None)
             return response.text
-        except requests.exceptions.RequestException as e:
-            logging.error(f"Error fetching feed: {e}")
-            return None
+
+    def retry_truncated(self, attempts: int) -> bool:
+        """Wait before fetching a cut-off feed again, or log the final failure when no retries are left"""
+        if attempts >= self.truncated_retries:
+            logging.error(f"{self.last_error}; giving up after {attempts + 1} attempts")
+            return False
+        logging.warning(f"{self.last_error}, retrying in {self.truncated_retry_delay}s "
+                        f"({attempts + 1}/{self.truncated_retries})")
+        self.clock.wait(self.truncated_retry_delay)
+        return True
+
+    def is_truncated_feed(self, content: str) -> bool:
+        """Check whether feed content stops partway through the document"""
+        try:
+            self.load_feed_xml(content)
+        except ET.ParseError as e:
+            # Other parse errors mean a malformed feed that fetching again will not fix
+            return e.code in TRUNCATION_ERRORS
+        return False
+
+    def is_challenge_page(self, response: requests.Response) -> bool:
+        """Check whether a response is a Cloudflare challenge page instead of the feed"""
+        if response.headers.get('cf-mitigated', '').lower() == 'challenge':
+            return True
+        body = response.text[:5000]
+        if body.lstrip().startswith(('<?xml', '<rss')):
+            return False
+        return any(signature in body for signature in CHALLENGE_SIGNATURES)
             
+    def is_local_feed(self) -> bool:
+        """Check whether the feed is read from the filesystem rather than over HTTP"""
+        scheme = urlparse(self.base_url).scheme.lower()
+        # A single-letter scheme is a Windows drive letter
+        return scheme not in ('http', 'https') and (scheme in ('', 'file') or len(scheme) == 1)
+
+    def read_feed_file(self) -> Optional[str]:
+        """Read a saved feed from a local path or file:// URL"""
+        parsed = urlparse(self.base_url)
+        path = Path(unquote(parsed.path)) if parsed.scheme.lower() == 'file' else Path(self.base_url)
+        try:
+            data = path.read_bytes()
+        except OSError as e:
+            logging.error(f"Error reading feed file {path}: {e}")
+            return None
+
+        logging.info(f"Reading feed from file: {path}")
+        # Feeds saved from a browser are usually UTF-8; ones saved from the raw response are Windows-874
+        try:
+            return data.decode('utf-8-sig')
+        except UnicodeDecodeError:
+            return data.decode('cp874', errors='replace')
+
+    def is_within_allowed_time(self, now: Optional[datetime] = None) -> bool:
+        """Check whether the feed may be accessed at the given (or current) time"""
+        current_hour = (now or self.clock.now()).hour
+        return (
+            (12 <= current_hour < 13) or  # 12:01 - 12:59
+            (17 <= current_hour <= 23) or  # 17:01 - 23:59
+            (0 <= current_hour <= 8)       # 00:00 - 08:59
+        )
+
+    def load_feed_xml(self, content: str) -> ET.Element:
+        """Parse feed content into an XML tree, raising ET.ParseError for malformed feeds"""
+        # Remove any BOM or problematic characters
+        content = content.strip()
+        if content.startswith('<?xml'):
+            content = '<?xml version="1.0" encoding="utf-8"?>' + content[content.find('>')+1:]
+        return ET.fromstring(content)
+
+    def parse_raw_items(self, content: str) -> List[Dict]:
+        """
+        Parse the feed's items into dicts of every element's original text, before any conversion
+        Elements that appear more than once in an item are collected into a list
+        """
+        if not content:
+            return []
+
+        try:
+            root = self.load_feed_xml(content)
+        except ET.ParseError as e:
+            logging.error(f"Error parsing XML: {e}")
+            logging.debug(f"Problematic content: {content[:500]}")
+            return []
+
+        items = []
+        for item in root.findall('.//item'):
+            fields = {}
+            for child in item:
+                name = child.tag.rsplit('}', 1)[-1]
+                if name in fields:
+                    if not isinstance(fields[name], list):
+                        fields[name] = [fields[name]]
+                    fields[name].append(child.text)
+                else:
+                    fields[name] = child.text
+            items.append(fields)
+        return items
+
+    def fetch_raw_items(self, **kwargs) -> Optional[List[Dict]]:
+        """
+        Fetch the feed and return its items as they appear in the feed, for inspecting feed problems
+        Takes the same parameters as fetch_feed; returns None when the feed could not be fetched
+        """
+        content = self.fetch_feed(**kwargs)
+        if not content:
+            return None
+        return self.parse_raw_items(content)
+
     def parse_feed(self, content: str) -> List[Dict]:
         """Parse the XML feed content and return a list of announcements"""
         if not content:
             return []
             
         try:
-            # Remove any BOM or problematic characters
-            content = content.strip()
-            if content.startswith('<?xml'):
-                content = '<?xml version="1.0" encoding="utf-8"?>' + content[content.find('>')+1:]
-            
-            root = ET.fromstring(content)
+            root = self.load_feed_xml(content)
             announcements = []
             
             # Get countbyday if present
@@ -108,21 +343,98 @@ class EGPFeedScraper:
             if countbyday is not None:
                 logging.info(f"Total announcements for today: {countbyday.text}")
             
+            base_url = self.link_base_url(root)
             for item in root.findall('.//item'):
                 announcement = {
                     'title': item.find('title').text if item.find('title') is not None else '',
                     'link': item.find('link').text if item.find('link') is not None else '',
-                    'description': item.find('description').text if item.find('description') is not None else '',
+                    'description': self.clean_description(item.find('description').text) if item.find('description') is not None else '',
                     'published_date': item.find('pubDate').text if item.find('pubDate') is not None else ''
                 }
+                # Feed dates without an offset are Thai local time
+                announcement['published_date'] = to_storage(announcement['published_date'], assume_tz=BANGKOK) or ''
+                announcement['link'] = self.absolute_link(announcement['link'], base_url)
+                announcement.update(self.bounded_title(announcement['title']))
+                announcement['dept_id'] = self.item_dept_id(item, announcement['link'])
+                # The description ends with the announcement type ("..., ยกเลิกประกาศเชิญชวน")
+                announcement['notice_type'] = (classify_notice(announcement['title'])
+                                               or classify_notice(announcement['description'].split(',')[-1]))
                 announcements.append(announcement)
-                
             return announcements
         except ET.ParseError as e:
             logging.error(f"Error parsing XML: {e}")
             logging.debug(f"Problematic content: {content[:500]}")
             return []
             
+    def bounded_title(self, title: str) -> Dict:
+        """Cut an overlong title to the maximum length, keeping the whole title as full_title"""
+        title = title or ''
+        if len(title) <= self.max_title_length:
+            return {'title': title, 'full_title': None}
+        logging.warning(f"Title of {len(title)} characters cut to {self.max_title_length}")
+        return {'title': title[:self.max_title_length].rstrip(), 'full_title': title}
+
+    def link_base_url(self, root: ET.Element) -> str:
+        """Get the URL that relative item links are resolved against"""
+        # A saved feed file has no web location of its own, so use the channel link or the e-GP feed
+        if not self.is_local_feed():
+            return self.base_url
+        channel_link = root.find('./channel/link')
+        if channel_link is not None and channel_link.text and channel_link.text.strip():
+            return channel_link.text.strip()
+        return DEFAULT_FEED_URL
+
+    def absolute_link(self, link: str, base_url: str) -> str:
+        """Resolve a relative or protocol-relative (//host/...) item link to an absolute URL"""
+        link = (link or '').strip()
+        if not link:
+            return link
+        return urljoin(base_url, link)
+
+    def clean_description(self, description: Optional[str]) -> str:
+        """Strip HTML markup and collapse whitespace in an item description"""
+        if not description:
+            return ''
+        text = BeautifulSoup(description, 'html.parser').get_text(' ')
+        return ' '.join(text.split())
+
+    def item_dept_id(self, item: ET.Element, link: str) -> Optional[str]:
+        """Get the department a feed item itself names, from a department element or its link"""
+        for child in item:
+            name = child.tag.rsplit('}', 1)[-1].lower()
+            if name in DEPT_ELEMENT_NAMES and child.text and child.text.strip():
+                return normalize_dept_id(child.text)
+        return self.link_dept_id(link)
+
+    def link_dept_id(self, link: str) -> Optional[str]:
+        """Get the deptId query parameter of a link, if it carries one"""
+        query = parse_qs(urlparse(link).query)
+        dept_values = query.get('deptId') or query.get('deptid')
+        if dept_values and dept_values[0].strip():
+            return normalize_dept_id(dept_values[0])
+        return None
+
+    def infer_dept_id(self, link: str) -> str:
+        """Infer a department ID from an announcement link"""
+        for pattern, dept_id in self.dept_patterns:
+            if pattern.search(link):
+                return dept_id
+
+        # Fall back to a deptId query parameter when the link carries one
+        return self.link_dept_id(link) or UNKNOWN_DEPT_ID
+
+    def find_duplicate(self, announcement: Dict, existing: List[Dict]) -> Optional[int]:
+        """Return the ID of the most similar existing announcement above the threshold"""
+        best_id = None
+        best_score = self.duplicate_threshold
+        for candidate in existing:
+            if candidate['link'] == announcement['link']:
+                continue
+            score = title_similarity(announcement['title'], candidate['title'])
+            if score >= best_score:
+                best_id, best_score = candidate['id'], score
+        return best_id
+
     def process_feed(self, **kwargs) -> int:
         """
         Process the feed and store in database
@@ -144,12 +456,31 @@ class EGPFeedScraper:
         
         # Store announcements in database
         new_entries = 0
-        dept_id = kwargs.get('dept_id')  # Get department ID from request parameters
+        dept_id = normalize_dept_id(kwargs.get('dept_id'))  # Get department ID from request parameters
+        existing_by_dept = {}
         for announcement in announcements:
             try:
-                announcement_id = self.db.insert_announcement(announcement, dept_id)
+                # Combined feeds name each item's department; otherwise use the requested one
+                entry_dept_id = announcement.get('dept_id') or dept_id or self.infer_dept_id(announcement['link'])
+                if entry_dept_id not in existing_by_dept:
+                    existing_by_dept[entry_dept_id] = self.db.get_announcement_titles(entry_dept_id)
+                existing = existing_by_dept[entry_dept_id]
+
+                duplicate_of = self.find_duplicate(announcement, existing)
+                if duplicate_of:
+                    logging.warning(f"Likely duplicate of announcement {duplicate_of}: {announcement['title']}")
+                    announcement['duplicate_of'] = duplicate_of
+                if announcement.get('notice_type'):
+                    logging.info(f"Announcement is a {announcement['notice_type']} notice: {announcement['title']}")
+
+                announcement_id = self.db.insert_announcement(announcement, entry_dept_id)
                 if announcement_id:
                     new_entries += 1
+                    existing.append({
+                        'id': announcement_id,
+                        'link': announcement['link'],
+                        'title': announcement['title']
+                    })
             except Exception as e:
                 logging.error(f"Error storing announcement: {e}")
                 continue
@@ -33,6 +33,8 @@ def init_database(db_path: str = "data/database.sqlite"):
         # Create tables with new schema
         cursor.executescript("""
             -- Drop existing tables if they exist
+            DROP TABLE IF EXISTS dead_letter;
+            DROP TABLE IF EXISTS runs;
             DROP TABLE IF EXISTS procurement_details;
             DROP TABLE IF EXISTS downloads;
             DROP TABLE IF EXISTS announcements;
@@ -41,12 +43,17 @@ def init_database(db_path: str = "data/database.sqlite"):
             CREATE TABLE announcements (
                 id INTEGER PRIMARY KEY,
                 title TEXT NOT NULL,
+                full_title TEXT,
                 link TEXT UNIQUE NOT NULL,
                 published_date DATE,
                 description TEXT,
                 project_id TEXT,
                 dept_id TEXT,
                 announce_type TEXT,
+                duplicate_of INTEGER,
+                notice_type TEXT,
+                original_id INTEGER,
+                status TEXT DEFAULT 'open',
                 created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
                 updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
             );
@@ -66,17 +73,66 @@ def init_database(db_path: str = "data/database.sqlite"):
                 id INTEGER PRIMARY KEY,
                 announcement_id INTEGER,
                 budget_amount DECIMAL,
+                budget_min DECIMAL,
+                budget_max DECIMAL,
+                bid_security DECIMAL,
                 quantity INTEGER,
+                spec_items TEXT,
+                spec_text TEXT,
                 duration_years INTEGER,
                 duration_months INTEGER,
                 submission_date DATE,
                 submission_time TIME,
+                document_sale_start TEXT,
+                document_sale_end TEXT,
+                document_sale_start_date DATE,
+                document_sale_end_date DATE,
+                clarification_date TEXT,
+                submission_deadline TEXT,
+                submission_deadline_date DATE,
                 contact_phone TEXT,
                 contact_email TEXT,
+                contact_address TEXT,
+                province TEXT,
+                region TEXT,
+                delivery_location TEXT,
+                delivery_province TEXT,
+                reference_urls TEXT,
+                committee TEXT,
+                signatory_name TEXT,
+                signatory_position TEXT,
+                page_count INTEGER,
+                failed_pages INTEGER,
+                raw_text TEXT,
                 extracted_at TIMESTAMP,
                 FOREIGN KEY (announcement_id) REFERENCES announcements(id)
             );
             
+            -- Create pipeline run history table
+            CREATE TABLE runs (
+                id INTEGER PRIMARY KEY,
+                command TEXT NOT NULL,
+                status TEXT,
+                started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                finished_at TIMESTAMP,
+                entries_fetched INTEGER DEFAULT 0,
+                entries_processed INTEGER DEFAULT 0,
+                entries_skipped INTEGER DEFAULT 0,
+                entries_deferred INTEGER DEFAULT 0,
+                entries_filtered INTEGER DEFAULT 0,
+                entries_failed INTEGER DEFAULT 0,
+                bytes_downloaded INTEGER DEFAULT 0
+            );
+
+            CREATE TABLE dead_letter (
+                id INTEGER PRIMARY KEY,
+                announcement_id INTEGER UNIQUE,
+                error TEXT,
+                attempts INTEGER,
+                failed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (announcement_id) REFERENCES announcements(id)
+            );
+            
             -- Create indexes for better query performance
             CREATE INDEX idx_announcements_link ON announcements(link);
             CREATE INDEX idx_announcements_dept_id ON announcements(dept_id);
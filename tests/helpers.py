@@ -0,0 +1,160 @@
+import asyncio
+import shutil
+import tempfile
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Dict, List, Optional
+
+from database.database import Database
+
+class FakeClock:
+    """Clock whose time only moves when a test advances it or something sleeps on it"""
+
+    def __init__(self, start: datetime = datetime(2024, 1, 15, 3, 0, tzinfo=timezone.utc)):
+        self.current = start.timestamp()
+        self.elapsed = 0.0
+        self.sleeps = []
+
+    def now(self, tz=None) -> datetime:
+        return datetime.fromtimestamp(self.current, tz or timezone.utc)
+
+    def time(self) -> float:
+        return self.current
+
+    def monotonic(self) -> float:
+        return self.elapsed
+
+    def advance(self, seconds: float):
+        self.current += seconds
+        self.elapsed += seconds
+
+    async def sleep(self, seconds: float):
+        self.sleeps.append(seconds)
+        self.advance(seconds)
+
+    def wait(self, seconds: float):
+        self.sleeps.append(seconds)
+        self.advance(seconds)
+
+class FakeContent:
+    def __init__(self, chunks: List[bytes], delay: float = 0):
+        self.chunks = chunks
+        self.delay = delay
+
+    async def iter_chunked(self, size: int):
+        for chunk in self.chunks:
+            if self.delay:
+                await asyncio.sleep(self.delay)
+            yield chunk
+
+class FakeResponse:
+    """Stand-in for an aiohttp response, served as an async context manager"""
+
+    def __init__(self, status: int = 200, body: bytes = b'%PDF-1.4 test', headers: Optional[Dict] = None,
+                 url: str = 'http://93.184.216.34/doc.pdf', chunk_size: int = 8192, delay: float = 0):
+        self.status = status
+        self.headers = headers or {}
+        self.url = url
+        chunks = [body[i:i + chunk_size] for i in range(0, len(body), chunk_size)]
+        self.content = FakeContent(chunks, delay)
+
+    async def __aenter__(self):
+        return self
+
+    async def __aexit__(self, *exc):
+        return False
+
+class FakeSession:
+    """Stand-in for an aiohttp session that serves queued responses and records each request"""
+
+    def __init__(self, responses: List):
+        self.responses = list(responses)
+        self.requests = []
+        self.closed = False
+
+    def get(self, url: str, **kwargs):
+        self.requests.append((url, kwargs))
+        response = self.responses.pop(0)
+        if isinstance(response, Exception):
+            raise response
+        return response
+
+    async def close(self):
+        self.closed = True
+
+class FakeFeedResponse:
+    """Stand-in for a requests response to a feed request"""
+
+    def __init__(self, status_code: int = 200, text: str = '', headers: Optional[Dict] = None):
+        self.status_code = status_code
+        self.text = text
+        self.headers = headers or {}
+        self.encoding = None
+
+class FakeFeedSession:
+    """Stand-in for a requests session that serves queued feed responses and records each request"""
+
+    def __init__(self, responses: List):
+        self.responses = list(responses)
+        self.requests = []
+
+    def get(self, url: str, **kwargs):
+        self.requests.append((url, kwargs))
+        response = self.responses.pop(0)
+        if isinstance(response, Exception):
+            raise response
+        return response
+
+class FakeEngine:
+    """Text engine that serves fixed page texts and records how many pages were read"""
+    name = 'fake'
+
+    def __init__(self, pages: List[Optional[str]]):
+        self.pages = pages
+        self.pages_read = 0
+
+    def open_pages(self, data: bytes):
+        return len(self.pages), self.iter_pages()
+
+    def iter_pages(self):
+        for page in self.pages:
+            self.pages_read += 1
+            yield page
+
+def extract_pages(test, extractor, pages: List[Optional[str]]) -> Optional[Dict]:
+    """Run an extractor over a document made of the given page texts"""
+    extractor.engine = FakeEngine(pages)
+    path = temp_dir(test) / 'doc.pdf'
+    path.write_bytes(repr(pages).encode('utf-8'))
+    return extractor.parse_pdf(str(path))
+
+def temp_dir(test) -> Path:
+    """Create a directory removed when the test finishes"""
+    path = Path(tempfile.mkdtemp())
+    test.addCleanup(shutil.rmtree, path, True)
+    return path
+
+def open_database(test, path: Optional[Path] = None, **options) -> Database:
+    """Open an initialized database in a temporary directory, closed when the test finishes"""
+    db = Database(str(path or temp_dir(test) / 'test.sqlite'), **options)
+    db.connect()
+    db.init_database()
+    test.addCleanup(db.close)
+    return db
+
+def add_announcement(db: Database, number: int, dept_id: Optional[str] = '0307', **fields) -> int:
+    """Insert a feed announcement numbered for the test, returning its ID"""
+    announcement = {
+        'title': f'ประกวดราคาซื้อครุภัณฑ์ {number}',
+        'link': f'https://process3.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid={number}',
+        'description': f'{number}, ประกวดราคาอิเล็กทรอนิกส์ (e-bidding), ประกาศเชิญชวน',
+        'published_date': '2024-01-15 03:00:00',
+    }
+    announcement.update(fields)
+    return db.insert_announcement(announcement, dept_id)
+
+def add_details(db: Database, announcement_id: int, **columns):
+    """Insert a procurement details row for an announcement"""
+    columns['announcement_id'] = announcement_id
+    db.execute_write(f"INSERT INTO procurement_details ({', '.join(columns)}) VALUES ({', '.join('?' * len(columns))})",
+                     tuple(columns.values()))
@@ -0,0 +1,41 @@
+import json
+import unittest
+
+from utils.content_schema import EXTRACTED_DEFAULTS, SCHEMA_VERSION, load_content, unwrap_content, wrap_content
+from tests.helpers import temp_dir
+
+class UnwrapContentTest(unittest.TestCase):
+    def test_unversioned_content_gains_every_field(self):
+        payload = unwrap_content({'announcement': {'id': 1}, 'extracted': {'budget': {'amount': '1,000'}}})
+        extracted = payload['extracted']
+        self.assertEqual(extracted['budget'], {'amount': '1,000'})
+        for field in ('spec_items', 'reference_urls', 'bid_security', 'authority', 'notice_type',
+                      'delivery_location', 'spec_text'):
+            self.assertIn(field, extracted)
+
+    def test_version_7_gains_the_flattened_spec_text(self):
+        items = [{'description': 'โต๊ะทำงาน', 'quantity': 4, 'unit': 'ตัว'}]
+        payload = unwrap_content({'schema_version': 7, 'payload': {'extracted': {'spec_items': items}}})
+        self.assertEqual(payload['extracted'], {'spec_items': items, 'spec_text': None})
+
+    def test_current_content_is_unchanged(self):
+        payload = {'extracted': {'spec_text': 'โต๊ะทำงาน 4 ตัว'}}
+        self.assertEqual(unwrap_content(wrap_content(payload)), payload)
+
+    def test_stored_content_round_trips_through_the_envelope(self):
+        extracted = dict(EXTRACTED_DEFAULTS, budget={'amount': '1,250,000.00', 'amount_clean': '1250000.00'},
+                         spec_items=[{'description': 'เครื่องคอมพิวเตอร์', 'quantity': 10, 'unit': 'เครื่อง'}],
+                         reference_urls=['https://www.gprocurement.go.th'], bid_security=None, authority=None,
+                         notice_type=None, delivery_location=None, spec_text='เครื่องคอมพิวเตอร์ 10 เครื่อง')
+        payload = {'announcement': {'id': 1, 'title': 'ประกวดราคาซื้อเครื่องคอมพิวเตอร์'}, 'extracted': extracted}
+        path = temp_dir(self) / '1.json'
+        path.write_text(json.dumps(wrap_content(payload), ensure_ascii=False), encoding='utf-8')
+
+        self.assertEqual(json.loads(path.read_text(encoding='utf-8'))['schema_version'], SCHEMA_VERSION)
+        self.assertEqual(load_content(str(path)), payload)
+
+    def test_newer_version_is_refused(self):
+        self.assertIsNone(unwrap_content({'schema_version': SCHEMA_VERSION + 1, 'payload': {}}))
+
+if __name__ == '__main__':
+    unittest.main()
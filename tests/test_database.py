@@ -0,0 +1,274 @@
+import sqlite3
+import unittest
+from datetime import date
+
+from database.database import AnnouncementNotFound, Database
+from utils.timestamps import BANGKOK, format_display, to_display
+from tests.helpers import FakeClock, add_announcement, add_details, open_database, temp_dir
+
+class Locked:
+    """Wraps a cursor or connection so a method fails as if another connection held the lock"""
+
+    def __init__(self, target, method: str, failures: int, message: str = 'database is locked'):
+        self.target = target
+        self.method = method
+        self.failures = failures
+        self.message = message
+        self.calls = 0
+
+    def __getattr__(self, name):
+        attribute = getattr(self.target, name)
+        if name != self.method:
+            return attribute
+
+        def call(*args):
+            self.calls += 1
+            if self.calls <= self.failures:
+                raise sqlite3.OperationalError(self.message)
+            return attribute(*args)
+        return call
+
+class PublishedDateMigrationTest(unittest.TestCase):
+    def test_converts_old_feed_dates_once(self):
+        path = temp_dir(self) / 'test.sqlite'
+        db = open_database(self, path)
+        # As a database written before published dates were migrated
+        db.set_user_version(0)
+        rows = [
+            ('rfc822-offset', 'Mon, 15 Jan 2024 10:00:00 +0700'),
+            ('rfc822-gmt', 'Mon, 15 Jan 2024 10:00:00 GMT'),
+            ('iso-naive', '2024-01-15T10:00:00'),
+            ('stored', '2024-01-15 03:00:00'),
+            ('unparseable', 'sometime in January'),
+            ('missing', None),
+        ]
+        for name, published_date in rows:
+            db.cursor.execute("INSERT INTO announcements (title, link, published_date) VALUES (?, ?, ?)",
+                              (name, f'https://example.com/{name}', published_date))
+        db.conn.commit()
+
+        db.init_database()
+        db.cursor.execute("SELECT title, published_date FROM announcements")
+        migrated = dict(db.cursor.fetchall())
+        self.assertEqual(migrated, {
+            'rfc822-offset': '2024-01-15 03:00:00',
+            'rfc822-gmt': '2024-01-15 10:00:00',
+            # Feed times without an offset are Bangkok time
+            'iso-naive': '2024-01-15 03:00:00',
+            'stored': '2024-01-15 03:00:00',
+            'unparseable': 'sometime in January',
+            'missing': None,
+        })
+
+        self.assertEqual(db.user_version(), Database.PUBLISHED_DATES_VERSION)
+
+        # The next start neither shifts stored values again nor warns about the unparseable one
+        with self.assertNoLogs(level='WARNING'):
+            db.init_database()
+        db.cursor.execute("SELECT title, published_date FROM announcements")
+        self.assertEqual(dict(db.cursor.fetchall()), migrated)
+
+    def test_feed_date_with_an_offset_is_stored_in_utc_and_shown_in_bangkok_time(self):
+        db = open_database(self)
+        announcement_id = add_announcement(db, 1, published_date='Mon, 15 Jan 2024 10:00:00 +0700')
+
+        stored = db.get_announcement(announcement_id)['published_date']
+        self.assertEqual(stored, '2024-01-15 03:00:00')
+        self.assertEqual(to_display(stored).tzinfo, BANGKOK)
+        self.assertEqual(format_display(stored), '2024-01-15 10:00:00 +0700')
+
+class TenderDeadlineTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+
+    def add_tender(self, number, deadline, status='open'):
+        announcement_id = self.db.insert_announcement({
+            'title': f'Tender {number}',
+            'link': f'https://example.com/{number}',
+            'description': f'P{number}, e-bidding, ประกาศเชิญชวน',
+            'published_date': '2024-01-01 03:00:00',
+        })
+        self.db.cursor.execute("INSERT INTO procurement_details (announcement_id, submission_deadline_date) VALUES (?, ?)",
+                               (announcement_id, deadline))
+        self.db.cursor.execute("UPDATE announcements SET status = ? WHERE id = ?", (status, announcement_id))
+        self.db.conn.commit()
+        return announcement_id
+
+    def status(self, announcement_id):
+        return self.db.get_announcement(announcement_id)['status']
+
+    def test_closes_tenders_once_the_deadline_day_has_passed(self):
+        past = self.add_tender(1, '2024-01-14')
+        today = self.add_tender(2, '2024-01-15')
+        amended = self.add_tender(3, '2024-01-10', status='amended')
+        unknown = self.add_tender(4, None)
+
+        self.assertEqual(self.db.close_past_deadlines(date(2024, 1, 15)), 2)
+        self.assertEqual(self.status(past), 'closed')
+        self.assertEqual(self.status(today), 'open')
+        self.assertEqual(self.status(amended), 'closed')
+        self.assertEqual(self.status(unknown), 'open')
+        self.assertEqual({tender['id'] for tender in self.db.get_active_tenders()}, {today, unknown})
+
+    def test_cancelled_tender_stays_cancelled(self):
+        cancelled = self.add_tender(1, '2024-01-01', status='cancelled')
+        self.assertEqual(self.db.close_past_deadlines(date(2024, 1, 15)), 0)
+        self.assertEqual(self.status(cancelled), 'cancelled')
+
+class WriteAheadLogTest(unittest.TestCase):
+    def setUp(self):
+        self.path = temp_dir(self) / 'test.sqlite'
+        self.db = Database(str(self.path))
+        self.db.connect()
+        self.db.init_database()
+        self.addCleanup(self.db.close)
+
+    def add_announcements(self, count):
+        for number in range(count):
+            self.db.insert_announcement({
+                'title': f'Tender {number}',
+                'link': f'https://example.com/{number}',
+                'description': f'P{number}, e-bidding, ประกาศเชิญชวน',
+                'published_date': '2024-01-15 03:00:00',
+            })
+
+    def test_connects_in_wal_mode(self):
+        self.assertEqual(self.db.conn.execute("PRAGMA journal_mode").fetchone()[0], 'wal')
+
+    def test_readers_are_not_blocked_by_a_write(self):
+        self.add_announcements(2)
+        self.db.cursor.execute("UPDATE announcements SET title = 'changed'")
+        self.assertTrue(self.db.conn.in_transaction)
+
+        reader = sqlite3.connect(str(self.path), timeout=0)
+        self.addCleanup(reader.close)
+        titles = [row[0] for row in reader.execute("SELECT title FROM announcements ORDER BY id")]
+        self.assertEqual(titles, ['Tender 0', 'Tender 1'])
+        self.db.conn.rollback()
+
+    def test_close_checkpoints_every_completed_write(self):
+        self.add_announcements(5)
+        wal = self.path.with_name(self.path.name + '-wal')
+        self.assertGreater(wal.stat().st_size, 0)
+        self.db.close()
+
+        self.assertFalse(wal.exists() and wal.stat().st_size)
+        reopened = sqlite3.connect(str(self.path))
+        self.addCleanup(reopened.close)
+        self.assertEqual(reopened.execute("SELECT COUNT(*) FROM announcements").fetchone()[0], 5)
+
+class PragmaTest(unittest.TestCase):
+    def test_fresh_database_uses_the_configured_page_and_cache_size(self):
+        path = temp_dir(self) / 'test.sqlite'
+        db = open_database(self, path, page_size=8192, cache_size=-4096)
+        self.assertEqual(db.conn.execute("PRAGMA page_size").fetchone()[0], 8192)
+        self.assertEqual(db.conn.execute("PRAGMA cache_size").fetchone()[0], -4096)
+
+        # The page size is fixed once the database exists
+        db.close()
+        with self.assertLogs(level='WARNING'):
+            reopened = open_database(self, path, page_size=4096)
+        self.assertEqual(reopened.conn.execute("PRAGMA page_size").fetchone()[0], 8192)
+
+    def test_invalid_values_are_rejected(self):
+        for page_size in (256, 1000, 131072, '4096'):
+            with self.assertRaises(ValueError, msg=page_size):
+                Database(':memory:', page_size=page_size)
+        for cache_size in (2.5, '2000', True):
+            with self.assertRaises(ValueError, msg=cache_size):
+                Database(':memory:', cache_size=cache_size)
+
+class LockedWriteTest(unittest.TestCase):
+    def setUp(self):
+        self.clock = FakeClock()
+        self.db = open_database(self, clock=self.clock)
+
+    def titles(self):
+        self.db.cursor.execute("SELECT title FROM announcements ORDER BY id")
+        return [row['title'] for row in self.db.cursor.fetchall()]
+
+    def test_locked_statement_succeeds_once_the_lock_clears(self):
+        self.db.cursor = Locked(self.db.cursor, 'execute', failures=2)
+        announcement_id = add_announcement(self.db, 1)
+
+        self.db.cursor = self.db.cursor.target
+        self.assertIsNotNone(announcement_id)
+        self.assertEqual(self.titles(), ['ประกวดราคาซื้อครุภัณฑ์ 1'])
+        self.assertEqual(self.clock.sleeps, [0.1, 0.2])
+
+    def test_retry_keeps_earlier_uncommitted_writes(self):
+        add_announcement(self.db, 1)
+        self.db.cursor.execute("UPDATE announcements SET title = 'pending'")
+        self.db.cursor = Locked(self.db.cursor, 'execute', failures=1, message='database is busy')
+        self.db.execute_write("INSERT INTO announcements (title, link) VALUES ('second', 'https://example.com/2')")
+
+        self.db.cursor = self.db.cursor.target
+        self.db.conn.rollback()
+        self.assertEqual(self.titles(), ['pending', 'second'])
+
+    def test_locked_commit_is_retried_without_repeating_the_statement(self):
+        self.db.conn = Locked(self.db.conn, 'commit', failures=1)
+        self.db.execute_write("INSERT INTO announcements (title, link) VALUES ('only', 'https://example.com/1')")
+
+        self.db.conn = self.db.conn.target
+        self.assertEqual(self.titles(), ['only'])
+        self.assertEqual(self.clock.sleeps, [0.1])
+
+    def test_gives_up_while_the_database_stays_locked(self):
+        self.db.cursor = Locked(self.db.cursor, 'execute', failures=Database.WRITE_ATTEMPTS)
+        with self.assertRaises(sqlite3.OperationalError):
+            self.db.execute_write("DELETE FROM announcements")
+        self.assertEqual(self.db.cursor.calls, Database.WRITE_ATTEMPTS)
+        self.assertEqual(len(self.clock.sleeps), Database.WRITE_ATTEMPTS - 1)
+
+    def test_other_errors_are_not_retried(self):
+        self.db.cursor = Locked(self.db.cursor, 'execute', failures=1, message='no such table: missing')
+        with self.assertRaises(sqlite3.OperationalError):
+            self.db.execute_write("DELETE FROM announcements")
+        self.assertEqual(self.clock.sleeps, [])
+
+class GetAnnouncementTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+
+    def test_reads_back_an_inserted_row(self):
+        announcement_id = add_announcement(self.db, 7, dept_id='1509')
+        announcement = self.db.get_announcement(announcement_id)
+
+        self.assertEqual(announcement['id'], announcement_id)
+        self.assertEqual(announcement['title'], 'ประกวดราคาซื้อครุภัณฑ์ 7')
+        self.assertEqual(announcement['dept_id'], '1509')
+        self.assertEqual(announcement['status'], 'open')
+
+    def test_missing_row_raises_not_found(self):
+        with self.assertRaises(AnnouncementNotFound) as raised:
+            self.db.get_announcement(404)
+        self.assertEqual(raised.exception.announcement_id, 404)
+
+    def test_database_errors_propagate(self):
+        self.db.cursor.execute("DROP TABLE announcements")
+        with self.assertRaises(sqlite3.OperationalError):
+            self.db.get_announcement(1)
+
+class BudgetRangeTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        for number, budget in enumerate((500_000, 1_000_000, 2_500_000, 5_000_000), 1):
+            add_details(self.db, add_announcement(self.db, number), budget_amount=budget)
+
+    def budgets(self, *args, **kwargs):
+        return [row['budget_amount'] for row in self.db.get_announcements_by_budget_range(*args, **kwargs)]
+
+    def test_bounds_are_inclusive(self):
+        self.assertEqual(self.budgets(1_000_000, 2_500_000), [2_500_000, 1_000_000])
+
+    def test_no_upper_bound(self):
+        self.assertEqual(self.budgets(1_000_001), [5_000_000, 2_500_000])
+
+    def test_sort_direction_and_paging(self):
+        self.assertEqual(self.budgets(sort_desc=False), [500_000, 1_000_000, 2_500_000, 5_000_000])
+        self.assertEqual(self.budgets(limit=2, offset=1), [2_500_000, 1_000_000])
+        self.assertEqual(self.db.get_announcements_by_budget_range(limit=1)[0]['total_count'], 4)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,19 @@
+import unittest
+
+from utils.departments import normalize_dept_id
+
+class NormalizeDeptIdTest(unittest.TestCase):
+    def test_variants_share_one_canonical_id(self):
+        for dept_id in ('0307', '307', ' 0307 ', '๐๓๐๗', '๓๐๗', 307):
+            self.assertEqual(normalize_dept_id(dept_id), '0307', dept_id)
+
+    def test_full_length_and_non_numeric_ids_are_only_stripped(self):
+        self.assertEqual(normalize_dept_id(' 12345 '), '12345')
+        self.assertEqual(normalize_dept_id(' MOPH-01 '), 'MOPH-01')
+
+    def test_missing_ids(self):
+        self.assertIsNone(normalize_dept_id(None))
+        self.assertIsNone(normalize_dept_id('   '))
+
+if __name__ == '__main__':
+    unittest.main()
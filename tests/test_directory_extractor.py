@@ -0,0 +1,59 @@
+import csv
+import json
+import unittest
+from pathlib import Path
+
+from utils.directory_extractor import extract_directory
+from utils.pdf_extractor import PDFParseError
+from tests.helpers import temp_dir
+
+class NamedExtractor:
+    """Extractor whose result names the file it read, finding nothing in broken and failing on corrupt files"""
+
+    def parse_pdf(self, path):
+        if Path(path).stem == 'broken':
+            return None
+        if Path(path).stem == 'corrupt':
+            raise PDFParseError(path, ValueError('EOF marker not found'))
+        return {'page_count': 2, 'budget': {'amount_clean': '1000.00'}, 'raw_text': f'text of {Path(path).name}'}
+
+class ExtractDirectoryTest(unittest.TestCase):
+    def setUp(self):
+        self.directory = temp_dir(self)
+        for name in ('b.pdf', 'a.PDF', 'sub/c.pdf', 'sub/broken.pdf', 'sub/corrupt.pdf'):
+            path = self.directory / name
+            path.parent.mkdir(exist_ok=True)
+            path.write_bytes(b'%PDF-1.4 test')
+        (self.directory / 'notes.txt').write_text('not a PDF')
+        (self.directory / 'sub' / 'scan.pdf.zip').write_bytes(b'PK')
+
+    def test_one_result_per_pdf(self):
+        output = temp_dir(self) / 'results.json'
+        results = extract_directory(str(self.directory), str(output), workers=2, extractor=NamedExtractor())
+
+        self.assertEqual([Path(result['file']).relative_to(self.directory).as_posix() for result in results],
+                         ['a.PDF', 'b.pdf', 'sub/broken.pdf', 'sub/c.pdf', 'sub/corrupt.pdf'])
+        self.assertEqual((results[2]['extracted'], results[2]['error']), (None, None))
+        self.assertIsNone(results[4]['extracted'])
+        self.assertIn('EOF marker not found', results[4]['error'])
+        self.assertEqual(results[0]['extracted'], {'page_count': 2, 'budget': {'amount_clean': '1000.00'}})
+        self.assertEqual(json.loads(output.read_text(encoding='utf-8')), results)
+
+    def test_csv_output(self):
+        output = temp_dir(self) / 'results.csv'
+        extract_directory(str(self.directory), str(output), output_format='csv', extractor=NamedExtractor())
+
+        with open(output, encoding='utf-8-sig', newline='') as f:
+            rows = list(csv.DictReader(f))
+        self.assertEqual(len(rows), 5)
+        self.assertEqual([row['success'] for row in rows], ['True', 'True', 'False', 'True', 'False'])
+        self.assertEqual(rows[2]['error'], '')
+        self.assertEqual(rows[0]['budget_amount'], '1000.00')
+
+    def test_empty_directory(self):
+        output = temp_dir(self) / 'results.json'
+        self.assertEqual(extract_directory(str(temp_dir(self)), str(output), extractor=NamedExtractor()), [])
+        self.assertEqual(json.loads(output.read_text(encoding='utf-8')), [])
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,38 @@
+import unittest
+
+from openpyxl import load_workbook
+
+from scripts.dump_xlsx import HEADERS, export_xlsx
+from tests.helpers import add_announcement, add_details, open_database, temp_dir
+
+class ExportXlsxTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.output = temp_dir(self) / 'projects.xlsx'
+
+    def test_one_sheet_per_department_with_thai_headers(self):
+        first = add_announcement(self.db, 1, dept_id='0307')
+        add_details(self.db, first, budget_amount=1_250_000, duration_years='1', duration_months='6',
+                    contact_phone='02-123-4567')
+        add_announcement(self.db, 2, dept_id='1509')
+
+        self.assertEqual(export_xlsx(self.db.conn, str(self.output)), 2)
+        workbook = load_workbook(str(self.output))
+        self.assertEqual(workbook.sheetnames, ['0307', '1509'])
+
+        sheet = workbook['0307']
+        self.assertEqual([sheet.cell(row=1, column=col).value for col in range(1, len(HEADERS) + 1)],
+                         [name for name, _ in HEADERS])
+        self.assertEqual(sheet.cell(row=2, column=3).value, '1')
+        self.assertEqual(sheet.cell(row=2, column=4).value, 1_250_000)
+        self.assertEqual(sheet.cell(row=2, column=5).value, '1 ปี 6 เดือน')
+        self.assertEqual(sheet.cell(row=2, column=7).value, '02-123-4567')
+
+    def test_empty_database_still_has_a_sheet(self):
+        self.assertEqual(export_xlsx(self.db.conn, str(self.output)), 0)
+        workbook = load_workbook(str(self.output))
+        self.assertEqual(workbook.sheetnames, ['โครงการ'])
+        self.assertEqual(workbook['โครงการ'].cell(row=1, column=1).value, HEADERS[0][0])
+
+if __name__ == '__main__':
+    unittest.main()
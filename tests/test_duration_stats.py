@@ -0,0 +1,35 @@
+import unittest
+
+from utils.duration_stats import DurationStats
+
+class DurationStatsTest(unittest.TestCase):
+    def test_exact_percentiles_while_every_sample_is_kept(self):
+        stats = DurationStats()
+        for seconds in range(100, 0, -1):
+            stats.record('extract', seconds / 10)
+
+        self.assertEqual(stats.summary()['extract'], {'count': 100, 'p50': 5.0, 'p90': 9.0, 'p99': 9.9, 'max': 10.0})
+        self.assertIsNone(stats.percentile('download', 50))
+
+    def test_approximate_percentiles_with_bounded_memory(self):
+        stats = DurationStats(max_samples=500, seed=1)
+        for seconds in range(1, 10001):
+            stats.record('download', seconds / 1000)
+
+        summary = stats.summary()['download']
+        self.assertEqual(summary['count'], 10000)
+        self.assertEqual(summary['max'], 10.0)
+        self.assertAlmostEqual(summary['p50'], 5.0, delta=0.5)
+        self.assertAlmostEqual(summary['p90'], 9.0, delta=0.5)
+        self.assertAlmostEqual(summary['p99'], 9.9, delta=0.3)
+        self.assertEqual(len(stats._samples['download']), 500)
+
+    def test_stages_are_kept_apart(self):
+        stats = DurationStats()
+        stats.record('download', 2.0)
+        stats.record('store', 0.1)
+        self.assertEqual(stats.percentile('download', 99), 2.0)
+        self.assertEqual(stats.percentile('store', 50), 0.1)
+
+if __name__ == '__main__':
+    unittest.main()
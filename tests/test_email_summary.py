@@ -0,0 +1,98 @@
+import smtplib
+import unittest
+from datetime import datetime, timezone
+
+from utils.email_summary import RUN_TOTALS, send_summary
+
+def summary_of(projects, failed=0):
+    totals = {key: 0 for key, _ in RUN_TOTALS}
+    totals['entries_failed'] = failed
+    return {
+        'start': datetime(2024, 1, 14, 3, 0, tzinfo=timezone.utc),
+        'end': datetime(2024, 1, 15, 3, 0, tzinfo=timezone.utc),
+        'runs': [], 'failed_runs': 0, 'totals': totals,
+        'projects': projects, 'min_budget': 1_000_000,
+    }
+
+class FakeSMTP:
+    """Stand-in for smtplib.SMTP that records the session and can fail on sending"""
+    instances = []
+
+    def __init__(self, host, port, timeout=None):
+        self.host = host
+        self.port = port
+        self.calls = []
+        self.messages = []
+        self.error = None
+        FakeSMTP.instances.append(self)
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        return False
+
+    def starttls(self):
+        self.calls.append('starttls')
+
+    def login(self, username, password):
+        self.calls.append(('login', username, password))
+
+    def send_message(self, message):
+        if self.error:
+            raise self.error
+        self.messages.append(message)
+
+class FailingSMTP(FakeSMTP):
+    def __init__(self, *args, **kwargs):
+        super().__init__(*args, **kwargs)
+        self.error = smtplib.SMTPRecipientsRefused({'ops@example.com': (550, b'mailbox unavailable')})
+
+class SendSummaryTest(unittest.TestCase):
+    def setUp(self):
+        FakeSMTP.instances = []
+
+    def test_composes_and_sends_the_message(self):
+        project = {'title': 'ประกวดราคาซื้อเครื่องคอมพิวเตอร์ <10 เครื่อง>', 'link': 'https://example.com/1?a=1&b=2',
+                   'budget_amount': 2_500_000, 'submission_date': '15 มกราคม 2567', 'submission_time': '10.00',
+                   'province': 'เชียงใหม่'}
+        sent = send_summary(summary_of([project], failed=2), 'smtp.example.com', 'bidfeed@example.com',
+                            ['ops@example.com', 'buyer@example.com'], username='bidfeed', password='secret',
+                            smtp_class=FakeSMTP)
+
+        self.assertTrue(sent)
+        [smtp] = FakeSMTP.instances
+        self.assertEqual((smtp.host, smtp.port), ('smtp.example.com', 587))
+        self.assertEqual(smtp.calls, ['starttls', ('login', 'bidfeed', 'secret')])
+        [message] = smtp.messages
+        self.assertEqual(message['Subject'], 'Procurement summary: 1 projects, 2 failed entries')
+        self.assertEqual(message['From'], 'bidfeed@example.com')
+        self.assertEqual(message['To'], 'ops@example.com, buyer@example.com')
+        body = message.get_body(('html',)).get_content()
+        self.assertIn('ประกวดราคาซื้อเครื่องคอมพิวเตอร์ &lt;10 เครื่อง&gt;', body)
+        self.assertIn('href="https://example.com/1?a=1&amp;b=2"', body)
+        self.assertIn('เชียงใหม่', body)
+
+    def test_plain_connection_without_login(self):
+        send_summary(summary_of([]), 'localhost', 'bidfeed@example.com', ['ops@example.com'], port=25,
+                     use_tls=False, smtp_class=FakeSMTP)
+        [smtp] = FakeSMTP.instances
+        self.assertEqual(smtp.calls, [])
+        self.assertIn('No new projects.', smtp.messages[0].get_body(('html',)).get_content())
+
+    def test_smtp_failure_is_logged_not_raised(self):
+        with self.assertLogs(level='ERROR') as logs:
+            sent = send_summary(summary_of([]), 'smtp.example.com', 'bidfeed@example.com', ['ops@example.com'],
+                                smtp_class=FailingSMTP)
+        self.assertFalse(sent)
+        self.assertIn('Error sending summary email via smtp.example.com:587', logs.output[0])
+
+    def test_connection_failure_is_logged_not_raised(self):
+        def refuse(host, port, timeout=None):
+            raise ConnectionRefusedError('connection refused')
+        with self.assertLogs(level='ERROR'):
+            self.assertFalse(send_summary(summary_of([]), 'smtp.example.com', 'bidfeed@example.com',
+                                          ['ops@example.com'], smtp_class=refuse))
+
+if __name__ == '__main__':
+    unittest.main()
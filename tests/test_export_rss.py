@@ -0,0 +1,42 @@
+import unittest
+import xml.etree.ElementTree as ET
+from email.utils import parsedate_to_datetime
+
+from scripts.export_rss import build_rss
+from tests.helpers import add_announcement, add_details, open_database
+
+class BuildRssTest(unittest.TestCase):
+    def test_valid_rss_with_one_item_per_project(self):
+        db = open_database(self)
+        first = add_announcement(db, 1, published_date='2024-01-15 03:00:00')
+        add_details(db, first, budget_amount=1_250_000, submission_date='15 มกราคม 2567',
+                    submission_time='10:00', contact_phone='02-123-4567')
+        second = add_announcement(db, 2)
+        add_details(db, second, budget_amount=None)
+
+        root = ET.fromstring(build_rss(db.get_recent_projects()))
+        self.assertEqual((root.tag, root.get('version')), ('rss', '2.0'))
+        channel = root.find('channel')
+        for element in ('title', 'link', 'description', 'lastBuildDate'):
+            self.assertTrue(channel.findtext(element), element)
+
+        items = {item.findtext('guid'): item for item in channel.findall('item')}
+        self.assertEqual(len(items), 2)
+        item = items[db.get_announcement(first)['link']]
+        self.assertEqual(item.findtext('title'), 'ประกวดราคาซื้อครุภัณฑ์ 1')
+        self.assertEqual(item.find('guid').get('isPermaLink'), 'true')
+        self.assertEqual(item.findtext('description').split('\n'), [
+            'เลขที่โครงการ: 1',
+            'งบประมาณ: 1,250,000.00 บาท',
+            'กำหนดยื่นข้อเสนอ: 15 มกราคม 2567 10:00',
+            'ติดต่อ: 02-123-4567',
+        ])
+        published = parsedate_to_datetime(item.findtext('pubDate'))
+        self.assertEqual((published.hour, published.utcoffset().total_seconds()), (10, 7 * 3600))
+
+    def test_empty_feed(self):
+        root = ET.fromstring(build_rss([]))
+        self.assertEqual(root.find('channel').findall('item'), [])
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,92 @@
+import unittest
+
+from utils.extraction_cache import ExtractionCache
+from utils.pdf_extractor import PDFExtractor
+from tests.helpers import FakeClock, extract_pages, temp_dir
+
+class ExtractionCacheTest(unittest.TestCase):
+    def setUp(self):
+        self.clock = FakeClock()
+
+    def test_entry_expires_after_its_ttl(self):
+        cache = ExtractionCache(max_size=4, ttl_seconds=60, clock=self.clock)
+        cache.put('a', {'budget': 1})
+        self.clock.advance(60)
+        self.assertEqual(cache.get('a'), {'budget': 1})
+        self.clock.advance(1)
+        self.assertIsNone(cache.get('a'))
+        self.assertEqual(len(cache), 0)
+
+    def test_no_expiry_without_ttl(self):
+        cache = ExtractionCache(max_size=4, ttl_seconds=0, clock=self.clock)
+        cache.put('a', 1)
+        self.clock.advance(10 ** 6)
+        self.assertEqual(cache.get('a'), 1)
+
+    def test_evicts_the_least_recently_used(self):
+        cache = ExtractionCache(max_size=2, clock=self.clock)
+        cache.put('a', 1)
+        cache.put('b', 2)
+        cache.get('a')
+        cache.put('c', 3)
+        self.assertEqual((cache.get('a'), cache.get('b'), cache.get('c')), (1, None, 3))
+
+    def test_returns_copies(self):
+        cache = ExtractionCache(clock=self.clock)
+        value = {'items': [1]}
+        cache.put('a', value)
+        value['items'].append(2)
+        cache.get('a')['items'].append(3)
+        self.assertEqual(cache.get('a'), {'items': [1]})
+
+    def test_zero_size_disables_caching(self):
+        cache = ExtractionCache(max_size=0, clock=self.clock)
+        cache.put('a', 1)
+        self.assertIsNone(cache.get('a'))
+
+class DirectoryCacheTest(unittest.TestCase):
+    def setUp(self):
+        self.clock = FakeClock()
+        self.directory = str(temp_dir(self))
+
+    def test_entries_outlive_the_cache(self):
+        ExtractionCache(ttl_seconds=60, clock=self.clock, directory=self.directory).put('a', {'budget': 1})
+        self.assertEqual(ExtractionCache(ttl_seconds=60, clock=self.clock, directory=self.directory).get('a'),
+                         {'budget': 1})
+
+    def test_expired_entries_are_removed(self):
+        ExtractionCache(ttl_seconds=60, clock=self.clock, directory=self.directory).put('a', 1)
+        self.clock.advance(61)
+        cache = ExtractionCache(ttl_seconds=60, clock=self.clock, directory=self.directory)
+        self.assertIsNone(cache.get('a'))
+        self.assertEqual(list(cache.directory.iterdir()), [])
+
+    def test_loaded_entry_keeps_its_remaining_lifetime(self):
+        ExtractionCache(ttl_seconds=60, clock=self.clock, directory=self.directory).put('a', 1)
+        self.clock.advance(50)
+        cache = ExtractionCache(ttl_seconds=60, clock=self.clock, directory=self.directory)
+        self.assertEqual(cache.get('a'), 1)
+        self.clock.advance(11)
+        self.assertIsNone(cache.get('a'))
+
+class CachedParseTest(unittest.TestCase):
+    pages = ['ประกาศประกวดราคาซื้อเครื่องคอมพิวเตอร์ ราคากลาง 1,250,000.00 บาท ' * 3]
+
+    def test_second_parse_of_the_same_content_skips_the_engine(self):
+        extractor = PDFExtractor()
+        first = extract_pages(self, extractor, self.pages)
+        self.assertEqual(extractor.engine.pages_read, 1)
+
+        # A fresh engine over a new copy of the same bytes is never read
+        second = extract_pages(self, extractor, self.pages)
+        self.assertEqual(extractor.engine.pages_read, 0)
+        self.assertEqual(second, first)
+
+    def test_different_content_is_extracted(self):
+        extractor = PDFExtractor()
+        extract_pages(self, extractor, self.pages)
+        extract_pages(self, extractor, self.pages + ['ภาคผนวก'])
+        self.assertEqual(extractor.engine.pages_read, 2)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,347 @@
+import unittest
+from datetime import datetime, timezone
+from unittest import mock
+
+import requests
+
+from scripts.feed_scraper import UNKNOWN_DEPT_ID, EGPFeedScraper
+from tests.helpers import FakeClock, FakeFeedResponse, FakeFeedSession, open_database, temp_dir
+
+FEED = ('<?xml version="1.0" encoding="windows-874"?><rss version="2.0"><channel>'
+        '<item><title>ประกวดราคาซื้อเครื่องคอมพิวเตอร์</title>'
+        '<link>https://process3.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=67119457432</link>'
+        '<description>67119457432, ประกวดราคาอิเล็กทรอนิกส์ (e-bidding), ประกาศเชิญชวน</description>'
+        '<pubDate>Mon, 15 Jan 2024 10:00:00 +0700</pubDate></item>'
+        '</channel></rss>')
+
+CHALLENGE = '<html><head><title>Just a moment...</title></head><body>cf_chl_opt</body></html>'
+
+class ScraperTestCase(unittest.TestCase):
+    def scraper(self, responses, **options):
+        self.clock = FakeClock()
+        self.session = FakeFeedSession(responses)
+        return EGPFeedScraper(open_database(self), session=self.session, clock=self.clock, **options)
+
+class PooledSessionTest(unittest.TestCase):
+    def test_default_session_keeps_a_connection_pool(self):
+        scraper = EGPFeedScraper(open_database(self), clock=FakeClock())
+        adapter = scraper.session.adapters['https://']
+        self.assertIs(scraper.session.adapters['http://'], adapter)
+        self.assertEqual((adapter._pool_connections, adapter._pool_maxsize), (4, 4))
+
+    def test_sequential_fetches_share_the_session(self):
+        scraper = EGPFeedScraper(open_database(self), clock=FakeClock())
+        with mock.patch.object(scraper.session, 'get', side_effect=[FakeFeedResponse(200, FEED)] * 2) as get:
+            self.assertEqual(scraper.fetch_feed(backfill=True), FEED)
+            self.assertEqual(scraper.fetch_feed(backfill=True), FEED)
+        self.assertEqual(get.call_count, 2)
+
+class ChallengeRetryTest(ScraperTestCase):
+    def test_retries_after_a_challenge_page(self):
+        scraper = self.scraper([FakeFeedResponse(503, CHALLENGE), FakeFeedResponse(200, FEED)],
+                               challenge_retries=2, challenge_retry_delay=30.0)
+        self.assertEqual(scraper.fetch_feed(), FEED)
+        self.assertEqual(self.clock.sleeps, [30.0])
+        self.assertEqual(len(self.session.requests), 2)
+        self.assertIsNone(scraper.last_error)
+
+    def test_gives_up_once_retries_are_used(self):
+        scraper = self.scraper([FakeFeedResponse(200, CHALLENGE)] * 3,
+                               challenge_retries=2, challenge_retry_delay=30.0)
+        self.assertIsNone(scraper.fetch_feed())
+        self.assertEqual(self.clock.sleeps, [30.0, 30.0])
+        self.assertIn('Cloudflare challenge', scraper.last_error)
+
+    def test_no_retry_by_default(self):
+        scraper = self.scraper([FakeFeedResponse(403, CHALLENGE)])
+        self.assertIsNone(scraper.fetch_feed())
+        self.assertEqual(self.clock.sleeps, [])
+
+class InjectedSessionTest(ScraperTestCase):
+    def test_request_error(self):
+        scraper = self.scraper([requests.exceptions.ConnectionError('Name or service not known')])
+        self.assertIsNone(scraper.fetch_feed(dept_id='0307'))
+        self.assertIn('Error fetching feed', scraper.last_error)
+        url, kwargs = self.session.requests[0]
+        self.assertEqual(kwargs['params'], {'deptId': '0307'})
+
+    def test_error_status(self):
+        scraper = self.scraper([FakeFeedResponse(500, 'Internal Server Error')])
+        self.assertIsNone(scraper.fetch_feed())
+        self.assertEqual(scraper.last_error, 'Failed to fetch feed. Status code: 500')
+
+class TruncatedRetryTest(ScraperTestCase):
+    def test_retries_a_cut_off_body(self):
+        scraper = self.scraper([FakeFeedResponse(200, FEED[:150]), FakeFeedResponse(200, FEED)],
+                               truncated_retry_delay=5.0)
+        self.assertEqual(scraper.fetch_feed(), FEED)
+        self.assertEqual(self.clock.sleeps, [5.0])
+
+    def test_retries_a_reset_connection(self):
+        scraper = self.scraper([requests.exceptions.ChunkedEncodingError('Connection reset by peer'),
+                                FakeFeedResponse(200, FEED)], truncated_retry_delay=5.0)
+        self.assertEqual(scraper.fetch_feed(), FEED)
+        self.assertEqual(self.clock.sleeps, [5.0])
+
+    def test_gives_up_once_retries_are_used(self):
+        scraper = self.scraper([FakeFeedResponse(200, FEED[:150])] * 3,
+                               truncated_retries=2, truncated_retry_delay=5.0)
+        self.assertIsNone(scraper.fetch_feed())
+        self.assertEqual(self.clock.sleeps, [5.0, 5.0])
+        self.assertEqual(len(self.session.requests), 3)
+        self.assertIn('ended before the end', scraper.last_error)
+
+    def test_malformed_feed_is_not_retried(self):
+        scraper = self.scraper([FakeFeedResponse(200, FEED.replace('</title>', '</titel>'))])
+        self.assertEqual(scraper.fetch_feed(), FEED.replace('</title>', '</titel>'))
+        self.assertEqual(self.clock.sleeps, [])
+
+class FeedCacheTest(ScraperTestCase):
+    def test_not_modified_reuses_the_body(self):
+        headers = {'ETag': '"v1"', 'Last-Modified': 'Mon, 15 Jan 2024 03:00:00 GMT'}
+        scraper = self.scraper([FakeFeedResponse(200, FEED, headers), FakeFeedResponse(304)])
+        self.assertEqual(scraper.fetch_feed(dept_id='0307'), FEED)
+
+        self.assertEqual(scraper.fetch_feed(dept_id='0307'), FEED)
+        request_headers = scraper.session.requests[1][1]['headers']
+        self.assertEqual(request_headers['If-None-Match'], '"v1"')
+        self.assertEqual(request_headers['If-Modified-Since'], 'Mon, 15 Jan 2024 03:00:00 GMT')
+
+    def test_unchanged_body_is_parsed_with_current_settings(self):
+        scraper = self.scraper([FakeFeedResponse(200, FEED, {'ETag': '"v1"'}), FakeFeedResponse(304)])
+        [first] = scraper.parse_feed(scraper.fetch_feed(dept_id='0307'))
+
+        scraper.max_title_length = 10
+        [second] = scraper.parse_feed(scraper.fetch_feed(dept_id='0307'))
+        self.assertEqual(second['title'], first['title'][:10])
+        self.assertEqual(second['full_title'], first['title'])
+
+    def test_each_request_has_its_own_entry(self):
+        scraper = self.scraper([FakeFeedResponse(200, FEED, {'ETag': '"v1"'}), FakeFeedResponse(200, FEED)])
+        scraper.fetch_feed(dept_id='0307')
+        scraper.fetch_feed(dept_id='0308')
+        self.assertNotIn('If-None-Match', scraper.session.requests[1][1]['headers'])
+
+    def test_feed_without_validators_is_not_cached(self):
+        scraper = self.scraper([FakeFeedResponse(200, FEED, {'ETag': '"v1"'}), FakeFeedResponse(200, FEED),
+                                FakeFeedResponse(200, FEED)])
+        scraper.fetch_feed()
+        scraper.fetch_feed()
+        scraper.fetch_feed()
+        self.assertIn('If-None-Match', scraper.session.requests[1][1]['headers'])
+        self.assertNotIn('If-None-Match', scraper.session.requests[2][1]['headers'])
+
+class NoticeTypeTest(ScraperTestCase):
+    def test_announcement_type_in_the_description(self):
+        feed = FEED.replace('ประกาศเชิญชวน</description>', 'ยกเลิกประกาศเชิญชวน</description>')
+        [announcement] = self.scraper([]).parse_feed(feed)
+        self.assertEqual(announcement['notice_type'], 'cancellation')
+
+    def test_ordinary_title_mentioning_amendments(self):
+        feed = FEED.replace('ประกวดราคาซื้อเครื่องคอมพิวเตอร์', 'ประกวดราคาจ้างแก้ไขปัญหาน้ำท่วมขัง')
+        [announcement] = self.scraper([]).parse_feed(feed)
+        self.assertIsNone(announcement['notice_type'])
+
+def feed_of(*items):
+    """Feed body made of (title, link) items"""
+    entries = ''.join(f'<item><title>{title}</title><link>{link}</link>'
+                      f'<description>{link[-4:]}, e-bidding, ประกาศเชิญชวน</description>'
+                      f'<pubDate>Mon, 15 Jan 2024 10:00:00 +0700</pubDate></item>' for title, link in items)
+    return f'<?xml version="1.0" encoding="utf-8"?><rss version="2.0"><channel>{entries}</channel></rss>'
+
+class DuplicateTitleTest(ScraperTestCase):
+    def test_flags_a_re_announced_tender(self):
+        scraper = self.scraper([FakeFeedResponse(200, feed_of(
+            ('ประกวดราคาซื้อเครื่องคอมพิวเตอร์ จำนวน 10 เครื่อง', 'https://example.com/1001'),
+            ('ประกวดราคาซื้อเครื่องคอมพิวเตอร์ จำนวน ๑๐ เครื่อง', 'https://example.com/1002'),
+            ('ประกวดราคาจ้างก่อสร้างถนนคอนกรีตเสริมเหล็ก', 'https://example.com/1003'),
+        ))])
+        self.assertEqual(scraper.process_feed(dept_id='0307'), 3)
+
+        rows = {row['link'][-4:]: row for row in scraper.db.get_recent_announcements('0307', 10)}
+        self.assertIsNone(rows['1001']['duplicate_of'])
+        self.assertEqual(rows['1002']['duplicate_of'], rows['1001']['id'])
+        self.assertIsNone(rows['1003']['duplicate_of'])
+
+class AccessWindowTest(ScraperTestCase):
+    def scraper_at(self, hour):
+        scraper = self.scraper([FakeFeedResponse(200, FEED)])
+        scraper.clock = FakeClock(datetime(2024, 1, 15, hour, 30, tzinfo=timezone.utc))
+        return scraper
+
+    def test_warns_outside_the_window(self):
+        scraper = self.scraper_at(10)
+        with self.assertLogs(level='WARNING') as logs:
+            self.assertEqual(scraper.fetch_feed(), FEED)
+        self.assertIn('outside the allowed access periods', logs.output[0])
+
+    def test_backfill_ignores_the_window(self):
+        scraper = self.scraper_at(10)
+        with self.assertLogs(level='INFO') as logs:
+            self.assertEqual(scraper.fetch_feed(backfill=True), FEED)
+        self.assertFalse(any('outside the allowed' in line for line in logs.output))
+        self.assertTrue(any('Backfill run' in line for line in logs.output))
+
+    def test_window_hours(self):
+        scraper = self.scraper([])
+        allowed = [hour for hour in range(24) if scraper.is_within_allowed_time(datetime(2024, 1, 15, hour, 30))]
+        self.assertEqual(allowed, [0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 17, 18, 19, 20, 21, 22, 23])
+
+class LocalFeedTest(ScraperTestCase):
+    def test_saved_feed_file_produces_announcements(self):
+        path = temp_dir(self) / 'egpannouncerss.xml'
+        path.write_bytes(FEED.encode('cp874'))
+
+        for feed_url in (path.as_uri(), str(path)):
+            scraper = self.scraper([], feed_url=feed_url)
+            self.assertEqual(scraper.process_feed(dept_id='0307'), 1, feed_url)
+            [stored] = scraper.db.get_recent_announcements('0307', 10)
+            self.assertEqual(stored['title'], 'ประกวดราคาซื้อเครื่องคอมพิวเตอร์')
+            self.assertEqual(stored['project_id'], '67119457432')
+            self.assertEqual(self.session.requests, [])
+
+    def test_utf8_feed_file(self):
+        path = temp_dir(self) / 'saved.xml'
+        path.write_text(feed_of(('ประกวดราคาจ้างก่อสร้างอาคาร', 'https://example.com/1001')), encoding='utf-8')
+        scraper = self.scraper([], feed_url=path.as_uri())
+        [announcement] = scraper.parse_feed(scraper.read_feed_file())
+        self.assertEqual(announcement['title'], 'ประกวดราคาจ้างก่อสร้างอาคาร')
+
+    def test_missing_file(self):
+        with self.assertLogs(level='ERROR'):
+            self.assertEqual(self.scraper([], feed_url='file:///nonexistent/feed.xml').process_feed(), 0)
+
+class AbsoluteLinkTest(ScraperTestCase):
+    items = [('ประกวดราคาซื้อเครื่องคอมพิวเตอร์', '/egp2procmainWeb/jsp/procsearch.sch?pid=1001'),
+             ('ประกวดราคาจ้างก่อสร้างอาคาร', '//www.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1002'),
+             ('ประกวดราคาซื้อวัสดุสำนักงาน', 'https://example.com/procsearch.sch?pid=1003')]
+
+    def links(self, feed_url, feed=None):
+        scraper = self.scraper([], feed_url=feed_url)
+        return [announcement['link'] for announcement in scraper.parse_feed(feed or feed_of(*self.items))]
+
+    def test_remote_feed_resolves_against_the_feed_url(self):
+        self.assertEqual(self.links('https://process3.gprocurement.go.th/EPROCRssFeedWeb/egpannouncerss.xml'), [
+            'https://process3.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1001',
+            'https://www.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1002',
+            'https://example.com/procsearch.sch?pid=1003',
+        ])
+
+    def test_local_feed_resolves_against_the_channel_link(self):
+        feed = feed_of(*self.items).replace('<channel>', '<channel><link>https://egp.example.go.th/rss/</link>')
+        self.assertEqual(self.links('file:///data/feeds/egpannouncerss.xml', feed), [
+            'https://egp.example.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1001',
+            'https://www.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1002',
+            'https://example.com/procsearch.sch?pid=1003',
+        ])
+
+    def test_local_feed_without_a_channel_link_uses_the_e_gp_feed(self):
+        # The e-GP feed is served over plain HTTP, so protocol-relative links get http
+        self.assertEqual(self.links('file:///data/feeds/egpannouncerss.xml'), [
+            'http://process3.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1001',
+            'http://www.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1002',
+            'https://example.com/procsearch.sch?pid=1003',
+        ])
+
+class DeptIdTest(ScraperTestCase):
+    def test_variant_ids_are_stored_under_the_canonical_id(self):
+        scraper = self.scraper([FakeFeedResponse(200, feed_of(('ประกวดราคาซื้อวัสดุ', 'https://example.com/1001'))),
+                                FakeFeedResponse(200, feed_of(('ประกวดราคาจ้างก่อสร้าง', 'https://example.com/1002')))])
+        scraper.process_feed(dept_id='307')
+        scraper.process_feed(dept_id='๐๓๐๗')
+
+        stored = scraper.db.get_recent_announcements('0307', 10)
+        self.assertEqual(sorted(row['link'][-4:] for row in stored), ['1001', '1002'])
+        self.assertEqual({row['dept_id'] for row in stored}, {'0307'})
+
+class DeptInferenceTest(ScraperTestCase):
+    patterns = {r'//[^/]*moph\.go\.th/': '1509', r'pid=99\d+': '307'}
+
+    def test_sample_links_map_to_their_departments(self):
+        scraper = self.scraper([], dept_patterns=self.patterns)
+        for link, expected in (
+                ('https://procurement.moph.go.th/notice?pid=1001', '1509'),
+                ('https://process3.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=99123', '0307'),
+                ('https://process3.gprocurement.go.th/egp2procmainWeb/jsp/procsearch.sch?pid=1&deptId=๑๒๐๑', '1201'),
+                ('https://example.com/notice?pid=1002', UNKNOWN_DEPT_ID)):
+            self.assertEqual(scraper.infer_dept_id(link), expected, link)
+
+    def test_feed_without_a_department_stores_the_inferred_one(self):
+        scraper = self.scraper([FakeFeedResponse(200, feed_of(
+            ('ประกวดราคาซื้อยา', 'https://procurement.moph.go.th/notice?pid=1001'),
+            ('ประกวดราคาซื้อวัสดุ', 'https://example.com/notice?pid=1002'),
+        ))], dept_patterns=self.patterns)
+        self.assertEqual(scraper.process_feed(), 2)
+
+        self.assertEqual([row['link'][-4:] for row in scraper.db.get_recent_announcements('1509', 10)], ['1001'])
+        self.assertEqual([row['link'][-4:] for row in scraper.db.get_recent_announcements(UNKNOWN_DEPT_ID, 10)],
+                         ['1002'])
+
+class ReprocessTest(ScraperTestCase):
+    def test_same_item_twice_updates_the_existing_row(self):
+        revised = FEED.replace('ประกวดราคาซื้อเครื่องคอมพิวเตอร์', 'ประกวดราคาซื้อเครื่องคอมพิวเตอร์ จำนวน 20 เครื่อง')
+        scraper = self.scraper([FakeFeedResponse(200, FEED), FakeFeedResponse(200, revised)])
+        self.assertEqual(scraper.process_feed(dept_id='0307'), 1)
+        [first] = scraper.db.get_recent_announcements('0307', 10)
+
+        self.assertEqual(scraper.process_feed(dept_id='0307'), 1)
+        [second] = scraper.db.get_recent_announcements('0307', 10)
+        self.assertEqual(second['id'], first['id'])
+        self.assertEqual(second['title'], 'ประกวดราคาซื้อเครื่องคอมพิวเตอร์ จำนวน 20 เครื่อง')
+        self.assertIsNone(second['duplicate_of'])
+
+class DescriptionTest(ScraperTestCase):
+    def test_html_is_stripped_before_storing(self):
+        feed = FEED.replace(
+            '<description>67119457432, ประกวดราคาอิเล็กทรอนิกส์ (e-bidding), ประกาศเชิญชวน</description>',
+            '<description>&lt;p&gt;67119457432,&lt;br/&gt; ประกวดราคาอิเล็กทรอนิกส์ (e-bidding),'
+            '\n &lt;b&gt;ประกาศเชิญชวน&lt;/b&gt;&lt;/p&gt;</description>')
+        scraper = self.scraper([FakeFeedResponse(200, feed)])
+        self.assertEqual(scraper.process_feed(dept_id='0307'), 1)
+
+        [stored] = scraper.db.get_recent_announcements('0307', 10)
+        self.assertEqual(stored['description'], '67119457432, ประกวดราคาอิเล็กทรอนิกส์ (e-bidding), ประกาศเชิญชวน')
+        self.assertEqual(stored['project_id'], '67119457432')
+        self.assertEqual(stored['announce_type'], 'ประกาศเชิญชวน')
+
+class TitleLengthTest(ScraperTestCase):
+    def test_long_title_is_cut_and_kept_whole_in_full_title(self):
+        title = 'ประกวดราคาซื้อเครื่องคอมพิวเตอร์ ' + 'ก' * 40
+        scraper = self.scraper([FakeFeedResponse(200, FEED.replace('ประกวดราคาซื้อเครื่องคอมพิวเตอร์', title))],
+                               max_title_length=20)
+        with self.assertLogs(level='WARNING') as logs:
+            self.assertEqual(scraper.process_feed(dept_id='0307'), 1)
+
+        [stored] = scraper.db.get_recent_announcements('0307', 10)
+        self.assertEqual(stored['title'], title[:20])
+        self.assertEqual(stored['full_title'], title)
+        self.assertIn(f'Title of {len(title)} characters cut to 20', logs.output[0])
+
+    def test_short_title_has_no_full_title(self):
+        scraper = self.scraper([FakeFeedResponse(200, FEED)], max_title_length=100)
+        scraper.process_feed(dept_id='0307')
+        [stored] = scraper.db.get_recent_announcements('0307', 10)
+        self.assertEqual(stored['title'], 'ประกวดราคาซื้อเครื่องคอมพิวเตอร์')
+        self.assertIsNone(stored['full_title'])
+
+class RawItemsTest(ScraperTestCase):
+    def test_items_come_back_as_they_appear_in_the_feed(self):
+        description = '<p>1001,<br/> ประกวดราคาอิเล็กทรอนิกส์ (e-bidding), <b>ประกาศเชิญชวน</b></p>'
+        feed = ('<?xml version="1.0" encoding="utf-8"?><rss version="2.0"><channel><item>'
+                '<title>  ประกวดราคาซื้อยา  </title><link>/notice?pid=1001</link>'
+                f'<description><![CDATA[{description}]]></description>'
+                '<pubDate>Mon, 15 Jan 2024 10:00:00 +0700</pubDate>'
+                '<category>ยา</category><category>เวชภัณฑ์</category>'
+                '</item></channel></rss>')
+        scraper = self.scraper([FakeFeedResponse(200, feed)], dept_patterns={r'pid=1001': '1509'})
+
+        self.assertEqual(scraper.fetch_raw_items(), [{
+            'title': '  ประกวดราคาซื้อยา  ',
+            'link': '/notice?pid=1001',
+            'description': description,
+            'pubDate': 'Mon, 15 Jan 2024 10:00:00 +0700',
+            'category': ['ยา', 'เวชภัณฑ์'],
+        }])
+
+if __name__ == '__main__':
+    unittest.main()
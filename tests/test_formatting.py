@@ -0,0 +1,21 @@
+import unittest
+
+from utils.formatting import format_thb
+
+class FormatTHBTest(unittest.TestCase):
+    def test_magnitudes(self):
+        for amount, expected in ((5, '5.00 บาท'), (950.5, '950.50 บาท'), (12_345.678, '12,345.68 บาท'),
+                                 (1_500_000, '1,500,000.00 บาท'), (2_750_000_000, '2,750,000,000.00 บาท')):
+            self.assertEqual(format_thb(amount), expected)
+
+    def test_zero(self):
+        self.assertEqual(format_thb(0), '0.00 บาท')
+        self.assertEqual(format_thb(-0.0), '0.00 บาท')
+        self.assertEqual(format_thb(None), '0.00 บาท')
+
+    def test_negative_amounts(self):
+        self.assertEqual(format_thb(-1_250.5), '-1,250.50 บาท')
+        self.assertEqual(format_thb(-3_000_000), '-3,000,000.00 บาท')
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,40 @@
+import unittest
+
+from utils.latency_tracker import LatencyTracker
+
+HOST = 'process3.gprocurement.go.th'
+
+class LatencyTrackerTest(unittest.TestCase):
+    def test_moving_average(self):
+        tracker = LatencyTracker(alpha=0.5, warn_threshold=100)
+        self.assertEqual(tracker.record(f'https://{HOST}/feed.xml', 2.0), 2.0)
+        self.assertAlmostEqual(tracker.record(f'https://{HOST}/feed.xml', 4.0), 3.0)
+        self.assertAlmostEqual(tracker.record(HOST, 1.0), 2.0)
+
+        tracker.record('https://example.com/doc.pdf', 9.0)
+        self.assertEqual(tracker.snapshot(), {HOST: 2.0, 'example.com': 9.0})
+
+    def test_warns_once_when_the_average_crosses_the_threshold(self):
+        tracker = LatencyTracker(alpha=0.5, warn_threshold=5.0)
+        tracker.record(HOST, 4.0)
+        self.assertFalse(tracker.is_slow(HOST))
+
+        with self.assertLogs(level='WARNING') as logs:
+            tracker.record(HOST, 8.0)
+            tracker.record(HOST, 9.0)
+        self.assertTrue(tracker.is_slow(HOST))
+        self.assertEqual(len(logs.output), 1)
+        self.assertIn(f'Average latency for {HOST} is 6.00s (threshold 5.00s)', logs.output[0])
+
+    def test_recovers_below_the_threshold(self):
+        tracker = LatencyTracker(alpha=0.5, warn_threshold=5.0)
+        with self.assertLogs(level='INFO') as logs:
+            tracker.record(HOST, 12.0)
+            tracker.record(HOST, 0.0)
+            tracker.record(HOST, 0.0)
+        self.assertFalse(tracker.is_slow(HOST))
+        self.assertAlmostEqual(tracker.get(HOST), 3.0)
+        self.assertTrue(any('recovered to 3.00s' in line for line in logs.output))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,73 @@
+import threading
+import time
+import unittest
+
+from utils.directory_extractor import extract_directory
+from utils.memory_guard import InFlightGuard
+from tests.helpers import temp_dir
+
+class InFlightGuardTest(unittest.TestCase):
+    def test_waits_until_memory_frees(self):
+        guard = InFlightGuard(max_bytes=100)
+        guard.acquire(80)
+        admitted = threading.Event()
+
+        def second():
+            with guard.hold(50):
+                admitted.set()
+        worker = threading.Thread(target=second)
+        worker.start()
+
+        self.assertFalse(admitted.wait(0.2))
+        self.assertEqual(guard.snapshot(), {'in_flight_bytes': 80, 'max_bytes': 100, 'waits': 1})
+        guard.release(80)
+        self.assertTrue(admitted.wait(2))
+        worker.join(2)
+        self.assertEqual(guard.snapshot()['in_flight_bytes'], 0)
+
+    def test_oversized_file_runs_alone(self):
+        guard = InFlightGuard(max_bytes=100)
+        with guard.hold(500):
+            self.assertEqual(guard.in_flight, 500)
+            self.assertFalse(guard.fits(1))
+        self.assertTrue(guard.fits(500))
+
+    def test_no_limit(self):
+        guard = InFlightGuard()
+        guard.acquire(10 ** 9)
+        self.assertTrue(guard.fits(10 ** 9))
+
+class RecordingExtractor:
+    """Extractor that tracks how many bytes of PDFs it is working on at once"""
+
+    def __init__(self):
+        self.lock = threading.Lock()
+        self.current = 0
+        self.peak = 0
+
+    def parse_pdf(self, path):
+        with open(path, 'rb') as f:
+            size = len(f.read())
+        with self.lock:
+            self.current += size
+            self.peak = max(self.peak, self.current)
+        time.sleep(0.05)
+        with self.lock:
+            self.current -= size
+        return {'page_count': 1}
+
+class DirectoryInFlightTest(unittest.TestCase):
+    def test_extractions_stay_under_the_ceiling(self):
+        directory = temp_dir(self)
+        for n in range(6):
+            (directory / f'{n}.pdf').write_bytes(b'%PDF' + b'x' * 56)
+        extractor = RecordingExtractor()
+
+        results = extract_directory(str(directory), str(directory / 'out.json'), workers=4,
+                                    extractor=extractor, max_in_flight_bytes=130)
+        self.assertEqual(len(results), 6)
+        self.assertTrue(all(result['extracted'] for result in results))
+        self.assertLessEqual(extractor.peak, 130)
+
+if __name__ == '__main__':
+    unittest.main()
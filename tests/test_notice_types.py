@@ -0,0 +1,42 @@
+import unittest
+
+from utils.notice_types import AMENDMENT, CANCELLATION, classify_notice
+
+class ClassifyNoticeTest(unittest.TestCase):
+    def test_cancellation_titles(self):
+        for title in ('ยกเลิกประกาศเชิญชวน ประกวดราคาซื้อเครื่องคอมพิวเตอร์',
+                      'ประกาศยกเลิกการประกวดราคาจ้างก่อสร้างอาคาร',
+                      'ยกเลิก การประกวดราคาซื้อวัสดุสำนักงาน',
+                      'Notice of Cancellation: Supply of Laboratory Analysers'):
+            self.assertEqual(classify_notice(title), CANCELLATION, title)
+
+    def test_amendment_titles(self):
+        for title in ('แก้ไขประกาศ ประกวดราคาซื้อเครื่องคอมพิวเตอร์',
+                      'ประกาศแก้ไขเพิ่มเติม เอกสารประกวดราคาจ้างก่อสร้าง',
+                      'Corrigendum to the invitation to bid'):
+            self.assertEqual(classify_notice(title), AMENDMENT, title)
+
+    def test_subject_line_of_a_document_heading(self):
+        heading = 'ประกาศ กรมสรรพากร เรื่อง ยกเลิกประกาศประกวดราคาซื้อเครื่องคอมพิวเตอร์ ด้วยวิธีประกวดราคาอิเล็กทรอนิกส์'
+        self.assertEqual(classify_notice(heading), CANCELLATION)
+        heading = 'ประกาศ โรงพยาบาลศูนย์ เรื่อง: แก้ไขประกาศประกวดราคาจ้างซ่อมแซมอาคาร'
+        self.assertEqual(classify_notice(heading), AMENDMENT)
+
+    def test_cancelled_amendment_is_a_cancellation(self):
+        self.assertEqual(classify_notice('ยกเลิกประกาศแก้ไขประกวดราคาซื้อวัสดุ'), CANCELLATION)
+
+    def test_mentions_outside_the_heading_are_ordinary(self):
+        for text in ('ประกวดราคาจ้างแก้ไขปัญหาน้ำท่วมขัง ตำบลบางพลี',
+                     'ประกวดราคาซื้อระบบยกเลิกคำสั่งซื้ออัตโนมัติ',
+                     'ประกาศ กรมสรรพากร เรื่อง ประกวดราคาซื้อเครื่องคอมพิวเตอร์ '
+                     'กรมฯ สงวนสิทธิ์ยกเลิกการประกวดราคาครั้งนี้ และอาจแก้ไขประกาศได้',
+                     'Supply of soil amendment material',
+                     'Invitation to bid; bids may be cancelled at any time'):
+            self.assertIsNone(classify_notice(text), text)
+
+    def test_empty(self):
+        self.assertIsNone(classify_notice(None))
+        self.assertIsNone(classify_notice(''))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,343 @@
+import asyncio
+import hashlib
+import os
+import unittest
+import zipfile
+from unittest import mock
+
+import aiohttp
+
+from utils.pdf_download import PDFDownloader, PublicAddressResolver
+from tests.helpers import FakeClock, FakeResponse, FakeSession, temp_dir
+
+PUBLIC_URL = 'http://93.184.216.34/doc.pdf'
+
+class FakeResolver:
+    def __init__(self, addresses):
+        self.addresses = addresses
+
+    async def resolve(self, host, port=0, family=0):
+        return [{'hostname': host, 'host': address, 'port': port} for address in self.addresses]
+
+    async def close(self):
+        pass
+
+class InjectedSessionTest(unittest.TestCase):
+    def test_batch_uses_the_injected_session_and_leaves_it_open(self):
+        session = FakeSession([FakeResponse(200, b'%PDF-1.4 first'), FakeResponse(200, b'%PDF-1.4 second')])
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), session=session, clock=FakeClock())
+
+        async def run():
+            async with downloader:
+                return [await downloader.download_pdf_result(f'http://93.184.216.34/{n}.pdf', f'P{n}')
+                        for n in (1, 2)]
+        results = asyncio.run(run())
+
+        self.assertEqual([result['size'] for result in results], [14, 15])
+        self.assertEqual([url for url, _ in session.requests],
+                         ['http://93.184.216.34/1.pdf', 'http://93.184.216.34/2.pdf'])
+        self.assertFalse(session.closed)
+
+class PooledSessionTest(unittest.TestCase):
+    def test_connector_settings(self):
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), clock=FakeClock(),
+                                   max_connections_per_host=2, keepalive_timeout=45)
+        with mock.patch.object(aiohttp, 'TCPConnector') as connector, mock.patch.object(aiohttp, 'ClientSession') as session:
+            downloader.create_session()
+
+        options = connector.call_args.kwargs
+        self.assertEqual((options['limit_per_host'], options['keepalive_timeout']), (2, 45))
+        self.assertIsInstance(options['resolver'], PublicAddressResolver)
+        session.assert_called_once_with(connector=connector.return_value)
+
+    def test_batch_reuses_one_session_for_sequential_downloads(self):
+        session = FakeSession([FakeResponse(200, b'%PDF-1.4 first'), FakeResponse(200, b'%PDF-1.4 second')])
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), clock=FakeClock())
+
+        async def run():
+            async with downloader:
+                for n in (1, 2):
+                    await downloader.download_pdf_result(f'http://93.184.216.34/{n}.pdf', f'P{n}')
+        with mock.patch.object(downloader, 'create_session', return_value=session) as create_session:
+            asyncio.run(run())
+
+        create_session.assert_called_once()
+        self.assertEqual(len(session.requests), 2)
+        self.assertTrue(session.closed)
+        self.assertIsNone(downloader.session)
+
+class DownloadResultTest(unittest.TestCase):
+    def test_result_describes_the_response(self):
+        body = b'%PDF-1.4 ' + b'x' * 20000
+        headers = {'Content-Type': 'application/pdf', 'Content-Length': str(len(body)), 'ETag': '"abc123"',
+                   'Last-Modified': 'Mon, 15 Jan 2024 03:00:00 GMT'}
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), clock=FakeClock(), session=FakeSession([
+            FakeResponse(200, body, headers, url='http://93.184.216.34/files/doc.pdf')]))
+        result = asyncio.run(downloader.download_pdf_result(PUBLIC_URL, 'P1'))
+
+        self.assertEqual(result, {
+            'path': str(downloader.output_dir / 'P1' / 'doc.pdf'),
+            'final_url': 'http://93.184.216.34/files/doc.pdf',
+            'size': len(body),
+            'content_type': 'application/pdf',
+            'etag': '"abc123"',
+            'last_modified': 'Mon, 15 Jan 2024 03:00:00 GMT',
+            'checksum': hashlib.sha256(body).hexdigest(),
+        })
+        self.assertEqual((downloader.output_dir / 'P1' / 'doc.pdf').read_bytes(), body)
+
+    def test_existing_file_has_no_response_fields(self):
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), clock=FakeClock(), session=FakeSession([]))
+        filepath = downloader.get_filepath(PUBLIC_URL, 'P1')
+        filepath.parent.mkdir()
+        filepath.write_bytes(b'%PDF-1.4 saved')
+
+        result = asyncio.run(downloader.download_pdf_result(PUBLIC_URL, 'P1'))
+        self.assertEqual((result['size'], result['checksum']), (14, hashlib.sha256(b'%PDF-1.4 saved').hexdigest()))
+        self.assertIsNone(result['final_url'])
+        self.assertIsNone(result['etag'])
+        self.assertEqual(asyncio.run(downloader.download_pdf(PUBLIC_URL, 'P1')), str(filepath))
+
+class HostCheckTest(unittest.TestCase):
+    def downloader(self, **options):
+        return PDFDownloader(output_dir=str(temp_dir(self)), clock=FakeClock(), **options)
+
+    def check(self, downloader, url):
+        return asyncio.run(downloader.check_host(url))
+
+    def test_allowed_host(self):
+        downloader = self.downloader(allowed_hosts=['gprocurement.go.th'], block_private_addresses=False)
+        self.assertIsNone(self.check(downloader, 'http://process3.gprocurement.go.th/doc.pdf'))
+        self.assertIn('not in the allowed hosts', self.check(downloader, 'http://example.com/doc.pdf'))
+
+    def test_denied_host(self):
+        downloader = self.downloader(denied_hosts=['bad.example'], block_private_addresses=False)
+        self.assertIn('is denied', self.check(downloader, 'http://files.bad.example/doc.pdf'))
+
+    def test_refused_download_creates_no_project_directory(self):
+        downloader = self.downloader(denied_hosts=['93.184.216.34'], session=FakeSession([]))
+        self.assertIsNone(asyncio.run(downloader.download_pdf(PUBLIC_URL, 'P1')))
+        self.assertEqual(list(downloader.output_dir.iterdir()), [])
+
+    def test_loopback_and_private_literals(self):
+        downloader = self.downloader()
+        for url in ('http://127.0.0.1/doc.pdf', 'http://169.254.169.254/latest', 'http://10.0.0.5/doc.pdf',
+                    'http://[::1]/doc.pdf'):
+            self.assertIn('non-public address', self.check(downloader, url), url)
+        self.assertIsNone(self.check(downloader, PUBLIC_URL))
+
+class RedirectTest(unittest.TestCase):
+    def fetch(self, responses, **options):
+        session = FakeSession(responses)
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), session=session, clock=FakeClock(), **options)
+        result = asyncio.run(downloader.download_pdf_result(PUBLIC_URL, 'P1'))
+        return result, session
+
+    def test_redirect_to_private_address_is_refused(self):
+        result, session = self.fetch([FakeResponse(302, b'', {'Location': 'http://169.254.169.254/latest'})])
+        self.assertIsNone(result)
+        self.assertEqual(len(session.requests), 1)
+        self.assertFalse(session.requests[0][1]['allow_redirects'])
+
+    def test_redirect_to_public_host_is_followed(self):
+        result, session = self.fetch([
+            FakeResponse(301, b'', {'Location': '/files/doc.pdf'}),
+            FakeResponse(200, b'%PDF-1.4 body', url='http://93.184.216.34/files/doc.pdf'),
+        ])
+        self.assertEqual(session.requests[1][0], 'http://93.184.216.34/files/doc.pdf')
+        self.assertEqual(result['final_url'], 'http://93.184.216.34/files/doc.pdf')
+
+    def test_redirect_limit(self):
+        loop = [FakeResponse(302, b'', {'Location': PUBLIC_URL}) for _ in range(3)]
+        result, session = self.fetch(loop, max_redirects=2)
+        self.assertIsNone(result)
+        self.assertEqual(len(session.requests), 3)
+
+class DownloadBudgetTest(unittest.TestCase):
+    def downloader(self, responses, max_total_bytes):
+        self.session = FakeSession(responses)
+        return PDFDownloader(output_dir=str(temp_dir(self)), session=self.session, clock=FakeClock(),
+                             max_total_bytes=max_total_bytes)
+
+    def download(self, downloader, number):
+        return asyncio.run(downloader.download_pdf_result(f'http://93.184.216.34/{number}.pdf', f'P{number}'))
+
+    def test_budget_running_out_partway_through_a_file(self):
+        body = b'%PDF-1.4 ' + b'x' * 15000
+        # Chunked responses: no Content-Length to check up front
+        downloader = self.downloader([FakeResponse(200, body), FakeResponse(200, body)], max_total_bytes=20000)
+
+        self.assertIsNotNone(self.download(downloader, 1))
+        self.assertIsNone(self.download(downloader, 2))
+        self.assertTrue(downloader.budget_exhausted())
+        self.assertLess(downloader.bytes_downloaded, 20000 + 8192)
+        self.assertEqual(list(downloader.output_dir.glob('P2/*')), [])
+
+        # Later downloads are not attempted
+        self.assertIsNone(self.download(downloader, 3))
+        self.assertEqual(len(self.session.requests), 2)
+
+    def test_announced_size_over_the_remaining_budget(self):
+        body = b'%PDF-1.4 ' + b'x' * 15000
+        downloader = self.downloader([FakeResponse(200, body, {'Content-Length': str(len(body))})],
+                                     max_total_bytes=10000)
+        self.assertIsNone(self.download(downloader, 1))
+        self.assertEqual(downloader.bytes_downloaded, 0)
+        self.assertTrue(downloader.budget_exhausted())
+
+    def test_budget_resets_each_run(self):
+        downloader = self.downloader([], max_total_bytes=100)
+        downloader.bytes_downloaded = 500
+        downloader.budget_reached = True
+        downloader.reset_download_budget()
+        self.assertFalse(downloader.budget_exhausted())
+
+class FileSizeLimitTest(unittest.TestCase):
+    def download(self, response, max_file_bytes):
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), session=FakeSession([response]),
+                                   clock=FakeClock(), max_file_bytes=max_file_bytes)
+        return asyncio.run(downloader.download_pdf_result(PUBLIC_URL, 'P1')), downloader
+
+    def test_streamed_file_over_the_limit_is_abandoned(self):
+        result, downloader = self.download(FakeResponse(200, b'%PDF-1.4 ' + b'x' * 50000), max_file_bytes=20000)
+        self.assertIsNone(result)
+        self.assertLessEqual(downloader.bytes_downloaded, 20000 + 8192)
+        self.assertEqual(list(downloader.output_dir.rglob('*.part')), [])
+
+    def test_announced_size_over_the_limit_is_refused(self):
+        body = b'%PDF-1.4 ' + b'x' * 50000
+        result, downloader = self.download(FakeResponse(200, body, {'Content-Length': str(len(body))}),
+                                           max_file_bytes=20000)
+        self.assertIsNone(result)
+        self.assertEqual(downloader.bytes_downloaded, 0)
+
+class OrphanSweepTest(unittest.TestCase):
+    def test_removes_old_orphans_only(self):
+        clock = FakeClock()
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), clock=clock, orphan_max_age=3600)
+        project_dir = downloader.output_dir / 'P1'
+        project_dir.mkdir()
+        now = clock.time()
+
+        orphan = project_dir / 'P1.pdf.part'
+        orphan.write_bytes(b'%PDF-1.4 partial')
+        os.utime(orphan, (now - 7200, now - 7200))
+        recent = project_dir / 'P2.pdf.part'
+        recent.write_bytes(b'%PDF-1.4 partial')
+        os.utime(recent, (now - 60, now - 60))
+        in_progress = project_dir / 'P3.pdf.part'
+        in_progress.write_bytes(b'%PDF-1.4 partial')
+        os.utime(in_progress, (now - 7200, now - 7200))
+        downloader.active_temp_files.add(in_progress)
+        finished = project_dir / 'P1.pdf'
+        finished.write_bytes(b'%PDF-1.4 done')
+        os.utime(finished, (now - 7200, now - 7200))
+
+        self.assertEqual(downloader.sweep_orphans(), 1)
+        self.assertFalse(orphan.exists())
+        self.assertTrue(recent.exists())
+        self.assertTrue(in_progress.exists())
+        self.assertTrue(finished.exists())
+
+class ZipExtractionTest(unittest.TestCase):
+    def setUp(self):
+        self.dir = temp_dir(self)
+        self.downloader = PDFDownloader(output_dir=str(self.dir / 'out'), clock=FakeClock(), max_file_bytes=20000)
+
+    def archive(self, members):
+        path = self.dir / 'archive.zip'
+        with zipfile.ZipFile(path, 'w', compression=zipfile.ZIP_DEFLATED) as archive:
+            for name, data in members.items():
+                archive.writestr(name, data)
+        return path
+
+    def test_extracts_the_largest_pdf(self):
+        archive = self.archive({'readme.txt': b'notes', 'annex.pdf': b'%PDF-1.4 annex',
+                                'tor/notice.pdf': b'%PDF-1.4 ' + b'x' * 1000})
+        target = self.dir / 'P1.pdf'
+
+        self.assertTrue(self.downloader.extract_pdf_from_zip(archive, target))
+        self.assertEqual(target.read_bytes(), b'%PDF-1.4 ' + b'x' * 1000)
+        self.assertEqual(list(self.dir.glob('*.part')), [])
+
+    def test_decompressed_size_over_the_limit_is_refused(self):
+        # A few hundred compressed bytes that inflate well past the limit
+        archive = self.archive({'notice.pdf': b'%PDF-1.4 ' + b'\0' * 200000})
+        self.assertLess(os.path.getsize(archive), 20000)
+        target = self.dir / 'P1.pdf'
+
+        with self.assertLogs(level='ERROR'):
+            self.assertFalse(self.downloader.extract_pdf_from_zip(archive, target))
+        self.assertFalse(target.exists())
+        self.assertEqual(list(self.dir.glob('*.part')), [])
+
+class RetryTestCase(unittest.TestCase):
+    def download(self, responses, **options):
+        self.clock = FakeClock()
+        self.session = FakeSession(responses)
+        downloader = PDFDownloader(output_dir=str(temp_dir(self)), session=self.session, clock=self.clock,
+                                   **options)
+        return asyncio.run(downloader.download_pdf_result(PUBLIC_URL, 'P1'))
+
+class RetryAfterTest(RetryTestCase):
+    def test_waits_the_seconds_the_server_asks_for(self):
+        result = self.download([FakeResponse(429, b'', {'Retry-After': '7'}), FakeResponse(200)])
+        self.assertIsNotNone(result)
+        self.assertEqual(self.clock.sleeps, [7.0])
+
+    def test_http_date_is_relative_to_the_clock(self):
+        # The fake clock starts at 2024-01-15 03:00:00 UTC
+        result = self.download([FakeResponse(503, b'', {'Retry-After': 'Mon, 15 Jan 2024 03:02:00 GMT'}),
+                                FakeResponse(200)])
+        self.assertIsNotNone(result)
+        self.assertEqual(self.clock.sleeps, [120.0])
+
+    def test_long_waits_are_capped(self):
+        self.download([FakeResponse(503, b'', {'Retry-After': '86400'}), FakeResponse(200)], max_retry_after=60)
+        self.assertEqual(self.clock.sleeps, [60.0])
+
+    def test_missing_or_unparseable_header_uses_the_retry_delay(self):
+        self.download([FakeResponse(503), FakeResponse(503, b'', {'Retry-After': 'soon'}), FakeResponse(200)],
+                      retry_delay=5)
+        self.assertEqual(self.clock.sleeps, [5, 5])
+
+    def test_gives_up_after_the_retries(self):
+        result = self.download([FakeResponse(503, b'', {'Retry-After': '1'})] * 3, max_retries=2)
+        self.assertIsNone(result)
+        self.assertEqual(self.clock.sleeps, [1.0, 1.0])
+        self.assertEqual(len(self.session.requests), 3)
+
+class RetryStatusesTest(RetryTestCase):
+    def test_not_found_is_not_retried(self):
+        self.assertIsNone(self.download([FakeResponse(404)]))
+        self.assertEqual(len(self.session.requests), 1)
+        self.assertEqual(self.clock.sleeps, [])
+
+    def test_unavailable_is_retried(self):
+        self.assertIsNotNone(self.download([FakeResponse(503), FakeResponse(200)]))
+        self.assertEqual(len(self.session.requests), 2)
+
+    def test_configured_statuses(self):
+        self.assertIsNotNone(self.download([FakeResponse(404), FakeResponse(200)], retry_statuses=(404,)))
+        self.assertEqual(len(self.session.requests), 2)
+        self.assertIsNone(self.download([FakeResponse(503)], retry_statuses=(404,)))
+        self.assertEqual(len(self.session.requests), 1)
+
+    def test_network_errors(self):
+        self.assertIsNotNone(self.download([aiohttp.ClientError('reset'), FakeResponse(200)]))
+        self.assertIsNone(self.download([aiohttp.ClientError('reset')], retry_network_errors=False))
+        self.assertEqual(len(self.session.requests), 1)
+
+class PublicAddressResolverTest(unittest.TestCase):
+    def test_drops_non_public_addresses(self):
+        resolver = PublicAddressResolver(FakeResolver(['10.1.2.3', '93.184.216.34']))
+        addresses = asyncio.run(resolver.resolve('mixed.example', 80))
+        self.assertEqual([a['host'] for a in addresses], ['93.184.216.34'])
+
+    def test_rejects_host_with_only_internal_addresses(self):
+        resolver = PublicAddressResolver(FakeResolver(['127.0.0.1']))
+        with self.assertRaises(OSError):
+            asyncio.run(resolver.resolve('rebound.example', 80))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,292 @@
+import unittest
+from unittest import mock
+
+from utils import pdf_extractor
+from utils.pdf_extractor import PDFExtractor, PDFParseError
+from tests.helpers import extract_pages, temp_dir
+
+def edited_rules(module_name):
+    """Stand-in for rule_module_source in which one rule module has been changed"""
+    read = pdf_extractor.rule_module_source
+
+    def source(name):
+        return read(name) + (b"\n# edited rule\n" if name == module_name else b'')
+    return mock.patch.object(pdf_extractor, 'rule_module_source', source)
+
+class RulesetHashTest(unittest.TestCase):
+    pages = ['ประกาศประกวดราคาซื้อเครื่องคอมพิวเตอร์ ราคากลาง 1,250,000.00 บาท ' * 3]
+
+    def test_every_rule_module_is_part_of_the_key(self):
+        before = PDFExtractor(cache_size=0).ruleset_hash
+        for name in pdf_extractor.RULE_MODULES:
+            with edited_rules(name):
+                self.assertNotEqual(PDFExtractor(cache_size=0).ruleset_hash, before, name)
+
+    def test_same_rules_same_key(self):
+        self.assertEqual(PDFExtractor(cache_size=0).ruleset_hash, PDFExtractor(cache_size=0).ruleset_hash)
+        self.assertNotEqual(PDFExtractor(cache_size=0).ruleset_hash,
+                            PDFExtractor(cache_size=0, language='en').ruleset_hash)
+
+    def test_rule_change_misses_the_cache_of_an_earlier_run(self):
+        cache_dir = str(temp_dir(self))
+        first = extract_pages(self, PDFExtractor(cache_dir=cache_dir), self.pages)
+
+        # A later process with the same rules reuses the stored result
+        unchanged = PDFExtractor(cache_dir=cache_dir)
+        self.assertEqual(extract_pages(self, unchanged, self.pages), first)
+        self.assertEqual(unchanged.engine.pages_read, 0)
+
+        with edited_rules('utils.thai_dates'):
+            changed = PDFExtractor(cache_dir=cache_dir)
+        extract_pages(self, changed, self.pages)
+        self.assertEqual(changed.engine.pages_read, 1)
+
+ENGLISH_NOTICE = """Invitation to Bid: Supply of Laboratory Analysers
+The Provincial Hospital invites bids with a budget of THB 2,450,000.00 for the supply of analysers.
+Bid security of 122,500 baht must accompany each bid.
+The contract period is 2 years (24 months).
+Submission deadline: 15 March 2024 at 10:30 hrs.
+For enquiries, Tel. 02-123-4567
+"""
+
+class EnglishDocumentTest(unittest.TestCase):
+    def test_english_only_document(self):
+        info = extract_pages(self, PDFExtractor(cache_size=0), [ENGLISH_NOTICE])
+
+        self.assertEqual(info['budget']['amount_clean'], '2450000.00')
+        self.assertEqual(info['bid_security']['amount_clean'], '122500')
+        self.assertEqual(info['duration'], {'years': '2', 'months': '24'})
+        self.assertEqual(info['submission_info']['date'], '15 March 2024')
+        self.assertEqual(info['submission_info']['time'], '10:30')
+        self.assertEqual(info['contact_info']['phone'], '02-123-4567')
+
+    def test_thai_patterns_alone_miss_english_fields(self):
+        info = extract_pages(self, PDFExtractor(cache_size=0, language='th'), [ENGLISH_NOTICE])
+        self.assertIsNone(info['budget'])
+        self.assertIsNone(info['duration'])
+
+class StreamingTest(unittest.TestCase):
+    closing = '\nสถานที่ส่งมอบ โรงพยาบาลนครพิงค์ ภายใน 30 วัน\n(นายสมชาย ใจดี)\nผู้อำนวยการโรงพยาบาลนครพิงค์'
+    pages = [
+        'ประกาศประกวดราคาซื้อเครื่องคอมพิวเตอร์ ราคากลาง 1,250,000.00 บาท ' * 3,
+        'ระยะเวลา 2 ปี (24 เดือน) ยื่นเอกสารวันที่ 15 มกราคม 2567 เวลา 10.00 น. สอบถามโทรศัพท์ 02-123-4567' + closing,
+        'เงื่อนไขอื่น ๆ ' * 20,
+        'ภาคผนวก ' * 20,
+    ]
+
+    def test_stops_once_every_target_is_found(self):
+        extractor = PDFExtractor(cache_size=0, streaming=True)
+        info = extract_pages(self, extractor, self.pages)
+
+        self.assertEqual(extractor.engine.pages_read, 2)
+        self.assertEqual(info['budget']['amount_clean'], '1250000.00')
+        self.assertEqual(info['duration'], {'years': '2', 'months': '24'})
+        self.assertEqual(info['contact_info']['phone'], '02-123-4567')
+        self.assertIn('date', info['submission_info'])
+
+    def test_reads_every_page_without_streaming(self):
+        extractor = PDFExtractor(cache_size=0)
+        extract_pages(self, extractor, self.pages)
+        self.assertEqual(extractor.engine.pages_read, 4)
+
+    def test_finds_a_field_split_across_pages(self):
+        pages = [self.pages[0] + 'ระยะเวลา', ' 2 ปี (24 เดือน) ยื่นเอกสารวันที่ 15 มกราคม 2567 เวลา 10.00 น.',
+                 'สอบถามโทรศัพท์ 02-123-4567' + self.closing] + self.pages[2:]
+        extractor = PDFExtractor(cache_size=0, streaming=True)
+        info = extract_pages(self, extractor, pages)
+
+        self.assertEqual(extractor.engine.pages_read, 3)
+        self.assertEqual(info['duration']['years'], '2')
+
+    def test_keeps_reading_for_a_signatory_near_the_end(self):
+        pages = [self.pages[0], self.pages[1].replace(self.closing, ''), self.pages[2], self.closing]
+        extractor = PDFExtractor(cache_size=0, streaming=True)
+        info = extract_pages(self, extractor, pages)
+
+        self.assertEqual(extractor.engine.pages_read, 4)
+        self.assertEqual(info['authority']['signatory']['name'], 'นายสมชาย ใจดี')
+        self.assertEqual(info['delivery_location']['location'], 'โรงพยาบาลนครพิงค์')
+
+    def test_fields_past_the_stopping_point_are_missed(self):
+        # The documented trade-off: only the target fields are waited for
+        pages = self.pages[:2] + ['หลักประกันการเสนอราคา จำนวน 62,500.00 บาท'] + self.pages[3:]
+        streamed = extract_pages(self, PDFExtractor(cache_size=0, streaming=True), pages)
+        full = extract_pages(self, PDFExtractor(cache_size=0), pages)
+
+        self.assertIsNone(streamed['bid_security'])
+        self.assertEqual(full['bid_security']['amount_clean'], '62500.00')
+
+    def test_each_page_is_searched_once(self):
+        extractor = PDFExtractor(cache_size=0, streaming=True)
+        searched = []
+        extract_budget = extractor.extract_budget
+
+        def recording_budget(text):
+            searched.append(len(text))
+            return extract_budget(text)
+        extractor.extract_budget = recording_budget
+        pages = ['เงื่อนไขอื่น ๆ ' * 40] * 5 + [self.pages[0] + self.pages[1]]
+        extract_pages(self, extractor, pages)
+
+        # One search per page while streaming, then one over the full text; the streaming
+        # searches never grow past a page plus the overlap
+        streaming_searches = searched[:-1]
+        self.assertEqual(len(streaming_searches), len(pages))
+        self.assertLessEqual(max(streaming_searches),
+                             max(len(page) for page in pages) + pdf_extractor.STREAMING_OVERLAP)
+
+class UnreadablePageTest(unittest.TestCase):
+    page = 'ประกาศประกวดราคาซื้อเครื่องคอมพิวเตอร์ ราคากลาง 1,250,000.00 บาท ' * 3
+
+    def test_broken_page_is_skipped_with_a_warning(self):
+        with self.assertLogs(level='WARNING') as logs:
+            info = extract_pages(self, PDFExtractor(cache_size=0), [self.page, None, self.page])
+
+        self.assertEqual(info['failed_pages'], 1)
+        self.assertEqual(info['page_count'], 3)
+        self.assertEqual(info['budget']['amount_clean'], '1250000.00')
+        self.assertTrue(any('Page 2' in line and line.startswith('WARNING') for line in logs.output))
+        self.assertTrue(any('1 of 3 pages could not be read' in line for line in logs.output))
+
+    def test_too_many_broken_pages_fail_the_extraction(self):
+        with self.assertLogs(level='WARNING') as logs:
+            info = extract_pages(self, PDFExtractor(cache_size=0), [self.page, None, None])
+
+        self.assertIsNone(info)
+        self.assertTrue(any(line.startswith('ERROR') and 'Too many unreadable pages' in line
+                            for line in logs.output))
+
+class InsufficientTextTest(unittest.TestCase):
+    def test_scanned_document_is_rejected_with_a_warning(self):
+        with self.assertLogs(level='WARNING') as logs:
+            info = extract_pages(self, PDFExtractor(cache_size=0), ['ประกาศ', '  ', ''])
+
+        self.assertIsNone(info)
+        self.assertTrue(any(line.startswith('WARNING') and '6 characters (minimum 100)' in line
+                            for line in logs.output))
+
+    def test_minimum_is_configurable(self):
+        info = extract_pages(self, PDFExtractor(cache_size=0, min_text_length=5), ['ประกาศ'])
+        self.assertEqual(info['raw_text'].strip(), 'ประกาศ')
+
+class ParseErrorTest(unittest.TestCase):
+    def test_unreadable_file_raises_instead_of_returning_nothing(self):
+        path = temp_dir(self) / 'missing.pdf'
+        with self.assertLogs(level='ERROR') as logs, self.assertRaises(PDFParseError) as raised:
+            PDFExtractor(cache_size=0).parse_pdf(str(path))
+
+        self.assertEqual(raised.exception.pdf_path, str(path))
+        self.assertIsInstance(raised.exception.__cause__, FileNotFoundError)
+        self.assertIn('Traceback', logs.output[0])
+
+class BudgetTest(unittest.TestCase):
+    def test_ranged_budget_is_filtered_on_its_upper_bound(self):
+        budget = PDFExtractor(cache_size=0).extract_budget(
+            'วงเงินงบประมาณ ตั้งแต่ 1,500,000.00 บาท ถึง 2,000,000.00 บาท')
+        self.assertEqual(budget, {'amount': '2,000,000.00', 'amount_clean': '2000000.00',
+                                  'min': '1500000.00', 'max': '2000000.00'})
+
+    def test_single_value_budget_has_no_bounds(self):
+        budget = PDFExtractor(cache_size=0).extract_budget(
+            'ราคากลาง 1,250,000.00 บาท หลักประกันการเสนอราคา จำนวน 62,500.00 บาท')
+        self.assertEqual(budget, {'amount': '1,250,000.00', 'amount_clean': '1250000.00',
+                                  'min': None, 'max': None})
+
+    def test_bid_guarantee_is_not_taken_as_the_budget(self):
+        # The guarantee comes first, so the first amount in baht is not the budget
+        pages = ['ประกาศกรมสรรพากร เรื่อง ประกวดราคาซื้อเครื่องคอมพิวเตอร์ ด้วยวิธีประกวดราคาอิเล็กทรอนิกส์\n'
+                 'ผู้ยื่นข้อเสนอต้องวางหลักประกันการเสนอราคา เป็นจำนวนเงิน 62,500.00 บาท\n',
+                 'ราคากลางของงานซื้อในการประกวดราคาครั้งนี้ เป็นเงินทั้งสิ้น 1,250,000.00 บาท\n']
+        info = extract_pages(self, PDFExtractor(cache_size=0), pages)
+
+        self.assertEqual(info['bid_security'], {'amount': '62,500.00', 'amount_clean': '62500.00'})
+        self.assertEqual(info['budget']['amount_clean'], '1250000.00')
+
+class ReferenceUrlTest(unittest.TestCase):
+    def test_links_are_deduplicated_and_validated(self):
+        urls = PDFExtractor(cache_size=0).extract_reference_urls(
+            'ดูรายละเอียดได้ที่เว็บไซต์www.gprocurement.go.thหรือ https://process3.gprocurement.go.th/egp2procmainWeb/,\n'
+            'สอบถามเพิ่มเติม https://process3.gprocurement.go.th/egp2procmainWeb/ และ http://localhost/x '
+            'หรือ (https://www.hospital.go.th/tor.pdf). ไม่ใช่ลิงก์ ftp://files.example.com/a.pdf www.')
+
+        self.assertEqual(urls, ['http://www.gprocurement.go.th',
+                                'https://process3.gprocurement.go.th/egp2procmainWeb/',
+                                'https://www.hospital.go.th/tor.pdf'])
+
+    def test_no_links(self):
+        self.assertIsNone(PDFExtractor(cache_size=0).extract_reference_urls('ไม่มีลิงก์ในเอกสารนี้'))
+
+class AddressTest(unittest.TestCase):
+    def test_address_flattened_from_several_lines(self):
+        info = PDFExtractor(cache_size=0).extract_contact_info(
+            'สอบถามรายละเอียดได้ที่\nที่อยู่ เลขที่ 110 ถนนอินทวโรรส\n  ตำบลศรีภูมิ อำเภอเมืองเชียงใหม่\n'
+            'จังหวัดเชียงใหม่ 50200\nโทรศัพท์ 053-123-456')
+        self.assertEqual(info['address'], 'เลขที่ 110 ถนนอินทวโรรส ตำบลศรีภูมิ อำเภอเมืองเชียงใหม่ จังหวัดเชียงใหม่ 50200')
+        self.assertEqual(info['phone'], '053-123-456')
+
+    def test_bangkok_address_with_abbreviations_and_thai_digits(self):
+        address = PDFExtractor(cache_size=0).extract_address(
+            'สถานที่ติดต่อ กองพัสดุ ๔๒๐/๖ ถ.ราชวิถี แขวงทุ่งพญาไท เขตราชเทวี กรุงเทพมหานคร ๑๐๔๐๐ ในวันและเวลาราชการ')
+        self.assertEqual(address, '๔๒๐/๖ ถ.ราชวิถี แขวงทุ่งพญาไท เขตราชเทวี กรุงเทพมหานคร ๑๐๔๐๐')
+
+    def test_configured_cue(self):
+        text = 'ส่งเอกสารมาที่ 99 หมู่ 3 ต.ในเมือง อ.เมือง จ.ขอนแก่น 40000'
+        self.assertIsNone(PDFExtractor(cache_size=0).extract_address(text))
+        self.assertEqual(PDFExtractor(cache_size=0, address_cues=('ส่งเอกสารมาที่',)).extract_address(text),
+                         '99 หมู่ 3 ต.ในเมือง อ.เมือง จ.ขอนแก่น 40000')
+
+class SubmissionWindowTest(unittest.TestCase):
+    def test_parses_the_submission_deadline(self):
+        windows = PDFExtractor(cache_size=0).extract_submission_windows(
+            'กำหนดยื่นข้อเสนอทางระบบจัดซื้อจัดจ้างภาครัฐด้วยอิเล็กทรอนิกส์ ในวันที่ ๑๕ มกราคม ๒๕๖๗ ระหว่างเวลา 09.00 น.')
+        self.assertEqual(windows['submission_deadline'], '๑๕ มกราคม ๒๕๖๗')
+        self.assertEqual(windows['submission_deadline_date'], '2024-01-15')
+        self.assertEqual(windows['document_sale_start'], '')
+        self.assertEqual(windows['document_sale_end'], '')
+        self.assertIsNone(windows['document_sale_start_date'])
+
+    def test_document_sale_period_and_deadline(self):
+        windows = PDFExtractor(cache_size=0).extract_submission_windows(
+            'ผู้สนใจสามารถดาวน์โหลดเอกสารประกวดราคาอิเล็กทรอนิกส์ได้ที่เว็บไซต์ www.gprocurement.go.th\n'
+            'ตั้งแต่วันที่ ๒ มกราคม ๒๕๖๗ ถึงวันที่ ๑๒ มกราคม ๒๕๖๗\n'
+            'ผู้ยื่นข้อเสนอจะต้องยื่นข้อเสนอทางระบบจัดซื้อจัดจ้างภาครัฐด้วยอิเล็กทรอนิกส์\n'
+            'ในวันที่ ๑๕ มกราคม ๒๕๖๗ ระหว่างเวลา ๐๙.๐๐ น. ถึง ๑๖.๓๐ น.')
+
+        self.assertEqual(windows['document_sale_start'], '๒ มกราคม ๒๕๖๗')
+        self.assertEqual(windows['document_sale_end'], '๑๒ มกราคม ๒๕๖๗')
+        self.assertEqual(windows['document_sale_start_date'], '2024-01-02')
+        self.assertEqual(windows['document_sale_end_date'], '2024-01-12')
+        self.assertEqual(windows['submission_deadline'], '๑๕ มกราคม ๒๕๖๗')
+        self.assertEqual(windows['submission_deadline_date'], '2024-01-15')
+        self.assertEqual(windows['clarification_date'], '')
+
+class SpecItemsTest(unittest.TestCase):
+    def test_multi_line_spec_block(self):
+        text = """รายละเอียดคุณลักษณะเฉพาะ
+1. เครื่องคอมพิวเตอร์สำหรับงานประมวลผล จำนวน 1,000 เครื่อง
+2. เครื่องพิมพ์เลเซอร์ จำนวน ๒๐ เครื่อง
+(3) ชุดโปรแกรมสำนักงาน จำนวน 5 ชุด
+"""
+        extractor = PDFExtractor(cache_size=0)
+        items = extractor.extract_spec_items(text)
+        self.assertEqual(items, [
+            {'description': 'เครื่องคอมพิวเตอร์สำหรับงานประมวลผล', 'quantity': 1000, 'unit': 'เครื่อง'},
+            {'description': 'เครื่องพิมพ์เลเซอร์', 'quantity': 20, 'unit': 'เครื่อง'},
+            {'description': 'ชุดโปรแกรมสำนักงาน', 'quantity': 5, 'unit': 'ชุด'},
+        ])
+        self.assertEqual(extractor.flatten_spec_items(items),
+                         'เครื่องคอมพิวเตอร์สำหรับงานประมวลผล 1000 เครื่อง; เครื่องพิมพ์เลเซอร์ 20 เครื่อง; '
+                         'ชุดโปรแกรมสำนักงาน 5 ชุด')
+
+    def test_separator_without_digits_is_skipped(self):
+        text = "1. ตู้เก็บเอกสาร จำนวน , ตู้\n2. โต๊ะทำงาน จำนวน 4 ตัว"
+        items = PDFExtractor(cache_size=0).extract_spec_items(text)
+        self.assertEqual(items, [{'description': 'โต๊ะทำงาน', 'quantity': 4, 'unit': 'ตัว'}])
+
+    def test_no_items(self):
+        extractor = PDFExtractor(cache_size=0)
+        self.assertIsNone(extractor.extract_spec_items('ประกาศประกวดราคา'))
+        self.assertIsNone(extractor.flatten_spec_items(None))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,474 @@
+import asyncio
+import contextlib
+import json
+import threading
+import time
+import unittest
+from datetime import datetime, timezone
+from pathlib import Path
+from unittest import mock
+
+from utils import pdf_processor
+from utils.pdf_download import PDFDownloader
+from utils.content_schema import SCHEMA_VERSION, load_content
+from utils.pdf_extractor import PDFExtractor, PDFParseError
+from utils.pdf_processor import PDFProcessor, process_announcements, reprocess_date_range, sample_announcements
+from utils.timestamps import BANGKOK
+from tests.helpers import (FakeClock, FakeResponse, FakeSession, add_announcement, add_details, extract_pages,
+                           open_database, temp_dir)
+
+class BlockingExtractor:
+    """Extractor that hangs on the first document until released and returns a result for the rest"""
+
+    def __init__(self):
+        self.release = threading.Event()
+        self.calls = []
+
+    def parse_pdf(self, path):
+        self.calls.append(path)
+        if len(self.calls) == 1:
+            self.release.wait(10)
+        return {'page_count': 3, 'failed_pages': 0}
+
+class EntryTimeoutTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.pdf = temp_dir(self) / 'doc.pdf'
+        self.pdf.write_bytes(b'%PDF-1.4 test')
+
+    def processor(self, **options):
+        processor = PDFProcessor(self.db, output_dir=None, **options)
+        processor.downloader.output_dir = temp_dir(self)
+        return processor
+
+    def test_slow_download_times_out_within_budget(self):
+        processor = self.processor(entry_timeout=0.2)
+
+        async def slow_download(url, project_id):
+            await asyncio.sleep(30)
+        processor.downloader.download_pdf = slow_download
+
+        announcement_id = add_announcement(self.db, 1)
+        started = time.monotonic()
+        results = asyncio.run(processor.process_batch([self.db.get_announcement(announcement_id)]))
+        self.assertLess(time.monotonic() - started, 2)
+        self.assertEqual(results, [False])
+        self.assertEqual(processor.stats['failed'], 1)
+        dead_letters = self.db.get_dead_letters()
+        self.assertEqual(dead_letters[0]['announcement_id'], announcement_id)
+        self.assertIn('timed out', dead_letters[0]['error'])
+
+    def test_stuck_extraction_does_not_block_later_entries(self):
+        extractor = BlockingExtractor()
+        self.addCleanup(extractor.release.set)
+        processor = self.processor(entry_timeout=0.3, extractor=extractor)
+
+        async def cached_download(url, project_id):
+            return str(self.pdf)
+        processor.downloader.download_pdf = cached_download
+
+        announcements = [self.db.get_announcement(add_announcement(self.db, n)) for n in (1, 2)]
+        results = asyncio.run(processor.process_batch(announcements))
+        self.assertEqual(results, [False, True])
+        self.assertTrue(self.db.has_procurement_details(announcements[1]['id']))
+
+    def test_stuck_extraction_keeps_its_bytes_in_flight(self):
+        extractor = BlockingExtractor()
+        self.addCleanup(extractor.release.set)
+        processor = self.processor(entry_timeout=0.3, extractor=extractor, max_in_flight_bytes=20)
+
+        async def cached_download(url, project_id):
+            return str(self.pdf)
+        processor.downloader.download_pdf = cached_download
+
+        announcements = [self.db.get_announcement(add_announcement(self.db, n)) for n in (1, 2)]
+        results = asyncio.run(processor.process_batch(announcements))
+        self.assertEqual(results, [False, False])
+        self.assertEqual(len(extractor.calls), 1)
+        self.assertEqual(processor.memory_guard.snapshot(), {'in_flight_bytes': 13, 'max_bytes': 20, 'waits': 1})
+
+class CorruptExtractor:
+    """Extractor for which every document is unreadable"""
+
+    def parse_pdf(self, path):
+        raise PDFParseError(path, ValueError('EOF marker not found'))
+
+class ParseErrorTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.pdf = temp_dir(self) / 'doc.pdf'
+        self.pdf.write_bytes(b'%PDF-1.4 test')
+
+    def process(self, extractor):
+        processor = PDFProcessor(self.db, extractor=extractor)
+
+        async def cached_download(url, project_id):
+            return str(self.pdf)
+        processor.downloader.download_pdf = cached_download
+        announcement = self.db.get_announcement(add_announcement(self.db, 1))
+        return announcement['id'], asyncio.run(processor.process_batch([announcement]))
+
+    def test_unreadable_pdf_is_dead_lettered(self):
+        announcement_id, results = self.process(CorruptExtractor())
+        self.assertEqual(results, [False])
+        [dead_letter] = self.db.get_dead_letters()
+        self.assertEqual(dead_letter['announcement_id'], announcement_id)
+        self.assertIn('EOF marker not found', dead_letter['error'])
+
+    def test_pdf_without_data_is_retried_next_run(self):
+        _, results = self.process(FixedExtractor(None))
+        self.assertEqual(results, [False])
+        self.assertEqual(self.db.get_dead_letters(), [])
+
+class FixedExtractor:
+    """Extractor that returns the same result for every document"""
+
+    def __init__(self, result):
+        self.result = result
+
+    def parse_pdf(self, path):
+        return self.result
+
+def budget_result(amount):
+    return {'page_count': 3, 'failed_pages': 0,
+            'budget': {'amount': amount, 'amount_clean': amount, 'min': None, 'max': None}}
+
+class ReextractTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.output_dir = temp_dir(self)
+        self.announcement = self.db.get_announcement(add_announcement(self.db, 1))
+
+    def reextract(self, result, extractor=None):
+        processor = PDFProcessor(self.db, extractor=extractor or FixedExtractor(result))
+        processor.downloader.output_dir = self.output_dir
+        filepath = processor.downloader.get_filepath(self.announcement['link'], self.announcement['project_id'])
+        filepath.parent.mkdir(parents=True, exist_ok=True)
+        filepath.write_bytes(b'%PDF-1.4 test')
+        return processor.reextract_batch([self.announcement])
+
+    def detail_rows(self):
+        self.db.cursor.execute("SELECT id, budget_amount FROM procurement_details WHERE announcement_id = ?",
+                               (self.announcement['id'],))
+        return [tuple(row) for row in self.db.cursor.fetchall()]
+
+    def test_updates_the_existing_details(self):
+        self.assertEqual(self.reextract(budget_result('1000')), [True])
+        [(detail_id, _)] = self.detail_rows()
+
+        self.assertEqual(self.reextract(budget_result('2500')), [True])
+        self.assertEqual(self.detail_rows(), [(detail_id, 2500.0)])
+
+    def test_ranged_budget_stores_its_bounds(self):
+        result = budget_result('2000000.00')
+        result['budget'].update({'min': '1500000.00', 'max': '2000000.00'})
+        self.assertEqual(self.reextract(result), [True])
+
+        details = self.db.get_procurement_details(self.announcement['id'])
+        self.assertEqual((details['budget_amount'], details['budget_min'], details['budget_max']),
+                         (2000000.0, 1500000.0, 2000000.0))
+
+    def test_failed_extraction_keeps_the_previous_details(self):
+        self.reextract(budget_result('1000'))
+        before = self.detail_rows()
+
+        self.assertEqual(self.reextract(None), [False])
+        self.assertEqual(self.detail_rows(), before)
+        self.assertEqual(self.reextract(None, extractor=CorruptExtractor()), [False])
+        self.assertEqual(self.detail_rows(), before)
+
+class DeadLetterTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.clock = FakeClock()
+        self.announcement = self.db.get_announcement(add_announcement(self.db, 1, link='http://93.184.216.34/1.pdf'))
+
+    def run_batch(self, responses):
+        processor = PDFProcessor(self.db, extractor=FixedExtractor(budget_result('1000')), clock=self.clock)
+        processor.downloader.output_dir = temp_dir(self)
+        processor.downloader.session = FakeSession(responses)
+        return processor, asyncio.run(processor.process_batch([self.announcement]))
+
+    def test_exhausted_retries_dead_letter_until_requeued(self):
+        # The first attempt and the downloader's three retries
+        attempts = 4
+        processor, results = self.run_batch([FakeResponse(503) for _ in range(attempts)])
+        self.assertEqual(results, [False])
+        [dead_letter] = self.db.get_dead_letters()
+        self.assertEqual(dead_letter['announcement_id'], self.announcement['id'])
+        self.assertEqual(dead_letter['attempts'], attempts)
+        self.assertIn('503', dead_letter['error'])
+
+        # Later runs leave a dead-lettered announcement alone
+        processor, results = self.run_batch([])
+        self.assertEqual(results, [])
+        self.assertEqual(processor.stats['skipped'], 1)
+
+        self.assertTrue(self.db.requeue_dead_letter(self.announcement['id']))
+        self.assertFalse(self.db.is_dead_lettered(self.announcement['id']))
+        processor, results = self.run_batch([FakeResponse(200)])
+        self.assertEqual(results, [True])
+        self.assertTrue(self.db.has_procurement_details(self.announcement['id']))
+        self.assertEqual(self.db.get_dead_letters(), [])
+
+class MinPagesTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.pdf = temp_dir(self) / 'doc.pdf'
+        self.pdf.write_bytes(b'%PDF-1.4 test')
+
+    def finish(self, page_count, min_pages):
+        announcement = self.db.get_announcement(add_announcement(self.db, page_count))
+        result = dict(budget_result('1000'), page_count=page_count)
+        processor = PDFProcessor(self.db, min_pages=min_pages)
+        processor.stats = {'filtered': 0}
+        return announcement['id'], processor, processor.finish_entry(announcement, result, str(self.pdf))
+
+    def test_one_page_document_is_filtered(self):
+        announcement_id, processor, stored = self.finish(page_count=1, min_pages=2)
+        self.assertFalse(stored)
+        self.assertEqual(processor.stats['filtered'], 1)
+        self.assertEqual(self.db.get_download_status(announcement_id), 'filtered')
+        self.assertFalse(self.db.has_procurement_details(announcement_id))
+
+    def test_multi_page_document_is_stored(self):
+        announcement_id, processor, stored = self.finish(page_count=5, min_pages=2)
+        self.assertTrue(stored)
+        self.assertEqual(processor.stats['filtered'], 0)
+        self.assertTrue(self.db.has_procurement_details(announcement_id))
+
+    def test_disabled_by_default(self):
+        announcement_id, _, stored = self.finish(page_count=1, min_pages=0)
+        self.assertTrue(stored)
+
+class RawTextTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.announcement_id = add_announcement(self.db, 1)
+        self.extracted = dict(budget_result('1250000.00'), raw_text='ประกาศ ราคากลาง 1,250,000.00 บาท')
+
+    def stored_raw_text(self, **options):
+        processor = PDFProcessor(self.db, **options)
+        self.assertTrue(processor.store_extracted_data(self.extracted, 'doc.pdf', self.announcement_id))
+        self.db.cursor.execute("SELECT raw_text FROM procurement_details WHERE announcement_id = ?",
+                               (self.announcement_id,))
+        return self.db.cursor.fetchone()['raw_text']
+
+    def test_stored_when_enabled(self):
+        self.assertEqual(self.stored_raw_text(store_raw_text=True), 'ประกาศ ราคากลาง 1,250,000.00 บาท')
+
+    def test_omitted_by_default(self):
+        self.assertIsNone(self.stored_raw_text())
+
+class JsonDumpTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.output_dir = temp_dir(self)
+        self.announcement = self.db.get_announcement(add_announcement(self.db, 1))
+
+    def test_processed_entry_is_written_as_json(self):
+        processor = PDFProcessor(self.db, output_dir=str(self.output_dir))
+        extracted = dict(budget_result('1250000.00'), raw_text='ราคากลาง 1,250,000.00 บาท')
+        path = processor.write_json_dump(self.announcement, extracted)
+
+        self.assertEqual(path, self.output_dir / f"{self.announcement['id']}.json")
+        self.assertEqual(list(self.output_dir.iterdir()), [path])
+        document = json.loads(path.read_text(encoding='utf-8'))
+        self.assertEqual(document['schema_version'], SCHEMA_VERSION)
+        payload = load_content(str(path))
+        self.assertEqual(payload['announcement']['id'], self.announcement['id'])
+        self.assertEqual(payload['announcement']['title'], 'ประกวดราคาซื้อครุภัณฑ์ 1')
+        self.assertEqual(payload['announcement']['project_id'], '1')
+        self.assertEqual(payload['extracted']['budget']['amount_clean'], '1250000.00')
+        self.assertNotIn('raw_text', payload['extracted'])
+
+    def test_identical_extractions_write_identical_bytes(self):
+        pages = ['ประกาศประกวดราคาซื้อครุภัณฑ์ ราคากลาง 1,250,000.00 บาท ระยะเวลา 2 ปี (24 เดือน)\n'
+                 'รายการ 1. เครื่องคอมพิวเตอร์ จำนวน 10 เครื่อง\n2. เครื่องพิมพ์ จำนวน 2 เครื่อง\n'
+                 'ดูรายละเอียด www.gprocurement.go.th และ https://process3.gprocurement.go.th/egp2procmainWeb/\n'
+                 'สถานที่ติดต่อ เลขที่ 110 ถนนอินทวโรรส ตำบลศรีภูมิ อำเภอเมืองเชียงใหม่ จังหวัดเชียงใหม่ 50200']
+        dumps = []
+        for _ in range(2):
+            output_dir = temp_dir(self)
+            processor = PDFProcessor(self.db, output_dir=str(output_dir))
+            extracted = extract_pages(self, PDFExtractor(cache_size=0), pages)
+            dumps.append(processor.write_json_dump(self.announcement, extracted).read_bytes())
+        self.assertEqual(dumps[0], dumps[1])
+
+class CompletedEntryTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.announcement = self.db.get_announcement(add_announcement(self.db, 1, link='http://93.184.216.34/1.pdf'))
+        add_details(self.db, self.announcement['id'], budget_amount=1000)
+
+    def run_batch(self, **options):
+        processor = PDFProcessor(self.db, extractor=FixedExtractor(budget_result('2500')), clock=FakeClock(),
+                                 **options)
+        processor.downloader.output_dir = temp_dir(self)
+        processor.downloader.session = FakeSession([FakeResponse(200)])
+        results = asyncio.run(processor.process_batch([self.announcement]))
+        return processor, results
+
+    def test_completed_entry_is_not_reprocessed(self):
+        processor, results = self.run_batch()
+        self.assertEqual(results, [])
+        self.assertEqual(processor.stats['skipped'], 1)
+        self.assertEqual(processor.downloader.session.requests, [])
+        self.assertEqual(self.db.get_procurement_details(self.announcement['id'])['budget_amount'], 1000)
+
+    def test_force_reprocesses_a_completed_entry(self):
+        processor, results = self.run_batch(force=True)
+        self.assertEqual(results, [True])
+        self.assertEqual(processor.stats['skipped'], 0)
+        self.assertEqual(self.db.get_procurement_details(self.announcement['id'])['budget_amount'], 2500)
+
+class RoutedSession(FakeSession):
+    """Fake session that answers each URL with its own response, whatever the request order"""
+
+    def __init__(self, routes):
+        super().__init__([])
+        self.routes = routes
+
+    def get(self, url, **kwargs):
+        self.requests.append((url, kwargs))
+        return self.routes[url]
+
+@contextlib.contextmanager
+def fake_pipeline(test, session, result=None, extractor=None, clock=None):
+    """Make the module-level pipelines download through a fake session and extract a fixed result"""
+    output_dir = str(temp_dir(test))
+    extractor = extractor or FixedExtractor(result or budget_result('2500'))
+    clock = clock or FakeClock()
+
+    def downloader(**options):
+        return PDFDownloader(output_dir=output_dir, session=session, **options)
+    with mock.patch.object(pdf_processor, 'PDFDownloader', downloader), \
+            mock.patch.object(pdf_processor, 'PDFExtractor', lambda **options: extractor), \
+            mock.patch.object(pdf_processor, 'SystemClock', lambda: clock):
+        yield output_dir
+
+class SlowExtractor(FixedExtractor):
+    """Extractor that takes a fixed time on the given clock for every document"""
+
+    def __init__(self, result, clock, seconds):
+        super().__init__(result)
+        self.clock = clock
+        self.seconds = seconds
+
+    def parse_pdf(self, path):
+        self.clock.advance(self.seconds)
+        return self.result
+
+class RunReportTest(unittest.TestCase):
+    def test_run_row_records_the_counts(self):
+        db = open_database(self)
+        completed, downloaded, missing = (add_announcement(db, n, link=f'http://93.184.216.34/{n}.pdf') for n in (1, 2, 3))
+        add_details(db, completed, budget_amount=1000)
+        body = b'%PDF-1.4 ' + b'x' * 100
+        session = RoutedSession({'http://93.184.216.34/2.pdf': FakeResponse(200, body),
+                                 'http://93.184.216.34/3.pdf': FakeResponse(404)})
+
+        with fake_pipeline(self, session):
+            process_announcements(db, dept_id='0307', limit=10)
+
+        [run] = db.get_recent_runs()
+        self.assertEqual(run['command'], 'extract')
+        self.assertEqual(run['status'], 'completed')
+        self.assertIsNotNone(run['finished_at'])
+        self.assertEqual((run['entries_fetched'], run['entries_processed'], run['entries_skipped'],
+                          run['entries_filtered'], run['entries_failed'], run['bytes_downloaded']),
+                         (3, 1, 1, 0, 1, len(body)))
+        self.assertTrue(db.has_procurement_details(downloaded))
+        self.assertFalse(db.has_procurement_details(missing))
+        self.assertEqual(db.get_download_status(downloaded), 'completed')
+        self.assertIsNone(db.get_download_status(missing))
+
+    def test_run_row_records_entries_deferred_by_the_time_limit(self):
+        db = open_database(self)
+        ids = [add_announcement(db, n, link=f'http://93.184.216.34/{n}.pdf') for n in (1, 2, 3)]
+        session = RoutedSession({f'http://93.184.216.34/{n}.pdf': FakeResponse(200) for n in (1, 2, 3)})
+        clock = FakeClock()
+
+        with fake_pipeline(self, session, extractor=SlowExtractor(budget_result('2500'), clock, 90), clock=clock):
+            process_announcements(db, dept_id='0307', limit=10, max_run_duration=60)
+
+        [run] = db.get_recent_runs()
+        self.assertEqual((run['status'], run['entries_fetched'], run['entries_processed'], run['entries_deferred'],
+                          run['entries_failed']), ('completed', 3, 1, 2, 0))
+        pending = [announcement_id for announcement_id in ids if not db.has_procurement_details(announcement_id)]
+        self.assertEqual(len(pending), 2)
+        self.assertFalse(any(db.is_dead_lettered(announcement_id) or db.get_download_status(announcement_id)
+                             for announcement_id in pending))
+        self.assertEqual(len(session.requests), 1)
+
+class SampleTest(unittest.TestCase):
+    announcements = [{'id': n} for n in range(1, 101)]
+
+    def test_keeps_the_fraction_in_order(self):
+        sampled = sample_announcements(self.announcements, 0.25)
+        self.assertEqual(len(sampled), 25)
+        self.assertEqual(sampled, sorted(sampled, key=lambda announcement: announcement['id']))
+        self.assertEqual(len(sample_announcements(self.announcements[:3], 0.5)), 2)
+
+    def test_same_seed_same_sample(self):
+        first = sample_announcements(self.announcements, 0.1, seed=7)
+        self.assertEqual(sample_announcements(self.announcements, 0.1, seed=7), first)
+        self.assertNotEqual(sample_announcements(self.announcements, 0.1, seed=8), first)
+
+    def test_without_a_fraction_everything_is_kept(self):
+        self.assertIs(sample_announcements(self.announcements, None), self.announcements)
+        self.assertIs(sample_announcements(self.announcements, 1), self.announcements)
+
+class ReprocessTest(unittest.TestCase):
+    def setUp(self):
+        self.db = open_database(self)
+        self.ids = {date: add_announcement(self.db, n, published_date=date, link=f'http://93.184.216.34/{n}.pdf')
+                    for n, date in enumerate(('2024-01-09 16:59:59', '2024-01-09 17:00:00',
+                                              '2024-01-10 16:59:59', '2024-01-10 17:00:00'), 1)}
+
+    def test_only_entries_in_range_are_reprocessed(self):
+        start = datetime(2024, 1, 10, tzinfo=BANGKOK)
+        end = datetime(2024, 1, 11, tzinfo=BANGKOK)
+        in_range = [self.ids['2024-01-09 17:00:00'], self.ids['2024-01-10 16:59:59']]
+        self.assertEqual([row['id'] for row in self.db.get_announcements_by_date_range(start, end)], in_range)
+
+        session = RoutedSession({f'http://93.184.216.34/{n}.pdf': FakeResponse(200) for n in (2, 3)})
+        with fake_pipeline(self, session):
+            reprocess_date_range(self.db, start, end)
+        self.assertEqual(sorted(url for url, _ in session.requests),
+                         ['http://93.184.216.34/2.pdf', 'http://93.184.216.34/3.pdf'])
+        self.assertEqual([self.db.has_procurement_details(i) for i in self.ids.values()], [False, True, True, False])
+
+    def test_denied_hosts_are_not_downloaded(self):
+        session = RoutedSession({})
+        with fake_pipeline(self, session) as output_dir:
+            reprocess_date_range(self.db, datetime(2024, 1, 1, tzinfo=BANGKOK), datetime(2024, 2, 1, tzinfo=BANGKOK),
+                                 denied_hosts=['93.184.216.34'])
+        self.assertEqual(session.requests, [])
+        self.assertEqual(list(Path(output_dir).iterdir()), [])
+        [run] = self.db.get_recent_runs()
+        self.assertEqual((run['command'], run['entries_failed']), ('reprocess', 4))
+
+class DeadlineCloseTest(unittest.TestCase):
+    def test_reextract_closes_tenders_by_the_processor_clock(self):
+        db = open_database(self)
+        announcement = db.get_announcement(add_announcement(db, 1))
+        result = dict(budget_result('1000'), submission_info={'submission_deadline': '10 มกราคม 2567',
+                                                               'submission_deadline_date': '2024-01-10'})
+        clock = FakeClock(datetime(2024, 1, 10, 3, 0, tzinfo=timezone.utc))
+        processor = PDFProcessor(db, extractor=FixedExtractor(result), clock=clock)
+        processor.downloader.output_dir = temp_dir(self)
+        filepath = processor.downloader.get_filepath(announcement['link'], announcement['project_id'])
+        filepath.parent.mkdir(parents=True, exist_ok=True)
+        filepath.write_bytes(b'%PDF-1.4 test')
+
+        processor.reextract_batch([announcement])
+        self.assertEqual(db.get_announcement(announcement['id'])['status'], 'open')
+
+        # 00:30 on 11 January in Bangkok is still 10 January in UTC
+        clock.advance(14.5 * 3600)
+        processor.reextract_batch([announcement])
+        self.assertEqual(db.get_announcement(announcement['id'])['status'], 'closed')
+
+if __name__ == '__main__':
+    unittest.main()
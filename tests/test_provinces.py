@@ -0,0 +1,44 @@
+import unittest
+
+from utils.provinces import CENTRAL, NORTH, NORTHEAST, PROVINCES, SOUTH, classify_province
+
+def province_name(text):
+    province = classify_province(text)
+    return province['name'] if province else None
+
+class ClassifyProvinceTest(unittest.TestCase):
+    def test_table_covers_every_province(self):
+        self.assertEqual(len(PROVINCES), 77)
+        self.assertEqual(len({thai for thai, _, _, _ in PROVINCES}), 77)
+
+    def test_phrasings_of_a_province(self):
+        for text, expected in (('ตำบลศรีภูมิ อำเภอเมือง จังหวัดเชียงใหม่ 50200', 'เชียงใหม่'),
+                               ('อ.เมือง จ.ขอนแก่น 40000', 'ขอนแก่น'),
+                               ('สำนักงานเขตราชเทวี กทม. 10400', 'กรุงเทพมหานคร'),
+                               ('ณ โรงพยาบาลมหาราช โคราช', 'นครราชสีมา'),
+                               ('Provincial Hospital, Chon Buri 20000', 'ชลบุรี'),
+                               ('Mueang District, CHIANG RAI', 'เชียงราย')):
+            self.assertEqual(province_name(text), expected, text)
+
+    def test_region_and_english_name(self):
+        self.assertEqual(classify_province('จังหวัดสงขลา'), {'name': 'สงขลา', 'name_en': 'Songkhla', 'region': SOUTH})
+        self.assertEqual(classify_province('กรุงเทพฯ')['region'], CENTRAL)
+        self.assertEqual(classify_province('Korat')['region'], NORTHEAST)
+
+    def test_ambiguous_words_need_a_province_cue(self):
+        # "เลย", "ตาก", "น่าน" and "แพร่" are also ordinary words
+        for text in ('ไม่ต้องยื่นเอกสารเลย', 'ตากแห้งไว้ก่อนส่งมอบ', 'ผ้าแพร่ไหม', 'ผ่านมานานแล้ว'):
+            self.assertIsNone(classify_province(text), text)
+        self.assertEqual(province_name('อำเภอเมือง จังหวัดเลย 42000'), 'เลย')
+        self.assertEqual(province_name('อ.แม่สอด จ.ตาก'), 'ตาก')
+        self.assertEqual(classify_province('จังหวัดน่าน')['region'], NORTH)
+
+    def test_cued_province_wins_over_an_earlier_mention(self):
+        self.assertEqual(province_name('ผู้ชนะจากชลบุรี ส่งมอบที่ จังหวัดระยอง'), 'ระยอง')
+
+    def test_no_province(self):
+        self.assertIsNone(classify_province('ประกวดราคาซื้อเครื่องคอมพิวเตอร์'))
+        self.assertIsNone(classify_province(None))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,86 @@
+import stat
+import sys
+import unittest
+from types import SimpleNamespace
+from unittest import mock
+
+from utils import text_engines
+from utils.pdf_extractor import PDFExtractor
+from utils.text_engines import PdftotextEngine, PyPDF2ColumnsEngine, PyPDF2Engine, get_engine
+from tests.helpers import extract_pages, temp_dir
+
+class FakePage:
+    """Page whose text is made of positioned fragments, recording each extraction pass"""
+
+    def __init__(self, fragments, width=600):
+        self.fragments = fragments
+        self.mediabox = SimpleNamespace(width=width)
+        self.extractions = 0
+
+    def extract_text(self, visitor_text=None):
+        self.extractions += 1
+        identity = [1, 0, 0, 1, 0, 0]
+        for x, y, text in self.fragments:
+            if visitor_text:
+                visitor_text(text, identity, [1, 0, 0, 1, x, y], None, 12)
+        return '\n'.join(text for _, _, text in self.fragments)
+
+def fake_pdftotext(test, output: str) -> str:
+    """Write an executable that ignores its input and prints the given text, as pdftotext would"""
+    path = temp_dir(test) / 'pdftotext'
+    path.write_text(f"#!{sys.executable}\nimport sys\nsys.stdin.buffer.read()\n"
+                    f"sys.stdout.buffer.write({output.encode('utf-8')!r})\n")
+    path.chmod(path.stat().st_mode | stat.S_IEXEC)
+    return str(path)
+
+class GetEngineTest(unittest.TestCase):
+    def test_selects_each_engine(self):
+        with mock.patch.object(PdftotextEngine, 'is_available', return_value=True):
+            for name in text_engines.ENGINES:
+                self.assertEqual(get_engine(name).name, name)
+
+    def test_missing_pdftotext_falls_back_to_pypdf2(self):
+        with mock.patch.object(PdftotextEngine, 'is_available', return_value=False):
+            self.assertIsInstance(get_engine('pdftotext'), PyPDF2Engine)
+
+    def test_unknown_engine(self):
+        with self.assertRaises(ValueError):
+            get_engine('tesseract')
+
+class PdftotextEngineTest(unittest.TestCase):
+    def test_splits_pages_on_form_feeds(self):
+        engine = PdftotextEngine(executable=fake_pdftotext(self, 'ประกาศประกวดราคา\fราคากลาง 1,000 บาท\f'))
+        self.assertTrue(engine.is_available())
+        page_count, pages = engine.open_pages(b'%PDF-1.4')
+        self.assertEqual((page_count, list(pages)), (2, ['ประกาศประกวดราคา', 'ราคากลาง 1,000 บาท']))
+
+    def test_same_fields_as_pypdf2(self):
+        pages = ['ราคากลาง 1,250,000.00 บาท ' * 5, 'ระยะเวลา 2 ปี (24 เดือน) สอบถามโทรศัพท์ 02-123-4567']
+
+        extractor = PDFExtractor(cache_size=0)
+        from_pages = extract_pages(self, extractor, pages)
+        extractor.engine = PdftotextEngine(executable=fake_pdftotext(self, '\f'.join(pages) + '\f'))
+        path = temp_dir(self) / 'doc.pdf'
+        path.write_bytes(b'%PDF-1.4')
+        with mock.patch('sys.stdout'):
+            from_pdftotext = extractor.parse_pdf(str(path))
+
+        for field in ('budget', 'duration', 'contact_info', 'page_count'):
+            self.assertEqual(from_pdftotext[field], from_pages[field], field)
+
+class ColumnTextTest(unittest.TestCase):
+    def test_reads_the_left_column_first(self):
+        page = FakePage([(50, 700, 'left one'), (350, 700, 'right one'),
+                         (50, 680, 'left two'), (350, 680, 'right two')])
+        text = PyPDF2ColumnsEngine().column_text(page)
+        self.assertEqual(text.split('\n'), ['left one', 'left two', 'right one', 'right two'])
+
+    def test_single_column_page_is_extracted_once(self):
+        page = FakePage([(50, 700, 'first line'), (50, 680, 'second line'), (50, 660, 'third line')])
+        engine = PyPDF2ColumnsEngine()
+        pages = list(engine.iter_pages(SimpleNamespace(pages=[page])))
+        self.assertEqual(pages, ['first line\nsecond line\nthird line'])
+        self.assertEqual(page.extractions, 1)
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,35 @@
+import unittest
+from datetime import date
+
+from utils.thai_dates import parse_thai_date, parse_thai_date_range
+
+class ParseThaiDateRangeTest(unittest.TestCase):
+    def test_buddhist_era_years(self):
+        self.assertEqual(parse_thai_date_range('ระหว่างวันที่ 1 มกราคม พ.ศ. 2567 ถึงวันที่ 15 มกราคม พ.ศ. 2567'),
+                         (date(2024, 1, 1), date(2024, 1, 15)))
+
+    def test_abbreviated_months(self):
+        self.assertEqual(parse_thai_date_range('3 มี.ค. 2567 - 10 เม.ย. 2567'),
+                         (date(2024, 3, 3), date(2024, 4, 10)))
+        self.assertEqual(parse_thai_date_range('3 มีค 2567 - 10 เมย 2567'),
+                         (date(2024, 3, 3), date(2024, 4, 10)))
+
+    def test_two_digit_years(self):
+        self.assertEqual(parse_thai_date_range('1 - 15 ม.ค. 67'), (date(2024, 1, 1), date(2024, 1, 15)))
+
+    def test_range_crossing_a_year_boundary(self):
+        self.assertEqual(parse_thai_date_range('28 ธ.ค. - 5 ม.ค. 2567'), (date(2023, 12, 28), date(2024, 1, 5)))
+
+    def test_thai_digits(self):
+        self.assertEqual(parse_thai_date_range('๑ มกราคม ๒๕๖๗ จนถึง ๑๕ มกราคม ๒๕๖๗'),
+                         (date(2024, 1, 1), date(2024, 1, 15)))
+
+    def test_end_before_start_is_rejected(self):
+        self.assertIsNone(parse_thai_date_range('15 มกราคม 2567 ถึง 1 มกราคม 2567'))
+        self.assertIsNone(parse_thai_date_range('ไม่มีวันที่'))
+
+    def test_single_date(self):
+        self.assertEqual(parse_thai_date('ยื่นเอกสารวันที่ ๑๕ ก.พ. ๖๗'), date(2024, 2, 15))
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,31 @@
+import unittest
+
+from utils.title_similarity import normalize_title, title_similarity
+
+class TitleSimilarityTest(unittest.TestCase):
+    def test_near_duplicate_titles(self):
+        pairs = [
+            ('ประกวดราคาซื้อเครื่องคอมพิวเตอร์ จำนวน 10 เครื่อง',
+             'ประกวดราคาซื้อเครื่องคอมพิวเตอร์  จำนวน ๑๐ เครื่อง'),
+            ('ประกวดราคาจ้างก่อสร้างอาคารเรียน',
+             'ประกวดราคาจ้าง ก่อสร้าง อาคารเรียน'),
+            ('Supply of laboratory analysers - Provincial Hospital',
+             'Provincial Hospital: supply of laboratory analysers'),
+        ]
+        for first, second in pairs:
+            self.assertGreaterEqual(title_similarity(first, second), 0.9, (first, second))
+
+    def test_distinct_titles(self):
+        pairs = [
+            ('ประกวดราคาซื้อเครื่องคอมพิวเตอร์ จำนวน 10 เครื่อง', 'ประกวดราคาจ้างก่อสร้างถนนคอนกรีตเสริมเหล็ก'),
+            ('Supply of laboratory analysers', 'Road resurfacing works on highway 304'),
+        ]
+        for first, second in pairs:
+            self.assertLess(title_similarity(first, second), 0.9, (first, second))
+
+    def test_empty_titles(self):
+        self.assertEqual(title_similarity('', 'ประกวดราคา'), 0.0)
+        self.assertEqual(title_similarity(None, None), 0.0)
+
+    def test_normalization(self):
+        self.assertEqual(normalize_title('ซื้อ​วัสดุ  (๒ รายการ)'), 'ซื้อวัสดุ 2 รายการ')
@@ -0,0 +1,50 @@
+import asyncio
+import time
+from datetime import datetime, tzinfo
+from typing import Optional, Protocol
+
+class Clock(Protocol):
+    """Time source taken by components whose behavior depends on time, so tests can substitute one"""
+
+    def now(self, tz: Optional[tzinfo] = None) -> datetime:
+        """Current wall-clock time"""
+        ...
+
+    def time(self) -> float:
+        """Current time as seconds since the epoch"""
+        ...
+
+    def monotonic(self) -> float:
+        """Seconds from a monotonic timer, for measuring durations"""
+        ...
+
+    async def sleep(self, seconds: float):
+        """Wait for the given number of seconds without blocking the event loop"""
+        ...
+
+    def wait(self, seconds: float):
+        """Block the calling thread for the given number of seconds"""
+        ...
+
+class SystemClock:
+    """Real time source, used wherever no other clock is given"""
+
+    def now(self, tz: Optional[tzinfo] = None) -> datetime:
+        """Current wall-clock time"""
+        return datetime.now(tz)
+
+    def time(self) -> float:
+        """Current time as seconds since the epoch"""
+        return time.time()
+
+    def monotonic(self) -> float:
+        """Seconds from a monotonic timer, for measuring durations"""
+        return time.monotonic()
+
+    async def sleep(self, seconds: float):
+        """Wait for the given number of seconds"""
+        await asyncio.sleep(seconds)
+
+    def wait(self, seconds: float):
+        """Block the calling thread for the given number of seconds"""
+        time.sleep(seconds)
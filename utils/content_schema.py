@@ -0,0 +1,104 @@
+import copy
+import json
+import logging
+from pathlib import Path
+from typing import Dict, Optional
+
+# Version of the stored announcement/extraction JSON written by this release
+SCHEMA_VERSION = 8
+
+# Extracted fields added after the first stored format, with the value meaning "not found"
+EXTRACTED_DEFAULTS = {
+    'page_count': None,
+    'failed_pages': 0,
+    'budget': None,
+    'specifications': None,
+    'spec_items': None,
+    'duration': None,
+    'submission_info': None,
+    'contact_info': None,
+    'province': None,
+}
+
+def wrap_content(payload: Dict) -> Dict:
+    """Wrap stored content in an envelope recording its schema version"""
+    return {'schema_version': SCHEMA_VERSION, 'payload': payload}
+
+def migrate_v1(payload: Dict) -> Dict:
+    """Upgrade a version 1 payload: fill in extracted fields it predates"""
+    extracted = payload.setdefault('extracted', {}) or {}
+    for key, default in EXTRACTED_DEFAULTS.items():
+        extracted.setdefault(key, default)
+    payload['extracted'] = extracted
+    return payload
+
+def migrate_v2(payload: Dict) -> Dict:
+    """Upgrade a version 2 payload: add the reference URLs field"""
+    payload['extracted'].setdefault('reference_urls', None)
+    return payload
+
+def migrate_v3(payload: Dict) -> Dict:
+    """Upgrade a version 3 payload: add the bid security field"""
+    payload['extracted'].setdefault('bid_security', None)
+    return payload
+
+def migrate_v4(payload: Dict) -> Dict:
+    """Upgrade a version 4 payload: add the committee and signatory field"""
+    payload['extracted'].setdefault('authority', None)
+    return payload
+
+def migrate_v5(payload: Dict) -> Dict:
+    """Upgrade a version 5 payload: add the amendment/cancellation notice type"""
+    payload['extracted'].setdefault('notice_type', None)
+    return payload
+
+def migrate_v6(payload: Dict) -> Dict:
+    """Upgrade a version 6 payload: add the delivery location field"""
+    payload['extracted'].setdefault('delivery_location', None)
+    return payload
+
+def migrate_v7(payload: Dict) -> Dict:
+    """Upgrade a version 7 payload: add the flattened specification text"""
+    payload['extracted'].setdefault('spec_text', None)
+    return payload
+
+# Each function upgrades a payload from its version to the next
+MIGRATIONS = {
+    1: migrate_v1,
+    2: migrate_v2,
+    3: migrate_v3,
+    4: migrate_v4,
+    5: migrate_v5,
+    6: migrate_v6,
+    7: migrate_v7,
+}
+
+def unwrap_content(document: Dict) -> Optional[Dict]:
+    """
+    Get the payload of stored content, migrated to the current schema version
+    Documents without an envelope are the original unversioned (version 1) format
+    """
+    if 'schema_version' in document:
+        version = document['schema_version']
+        payload = copy.deepcopy(document.get('payload') or {})
+    else:
+        version = 1
+        payload = copy.deepcopy(document)
+
+    if not isinstance(version, int) or version > SCHEMA_VERSION:
+        logging.error(f"Unsupported stored content schema version: {version}")
+        return None
+
+    while version < SCHEMA_VERSION:
+        payload = MIGRATIONS[version](payload)
+        version += 1
+    return payload
+
+def load_content(filepath: str) -> Optional[Dict]:
+    """Read a stored JSON file and return its payload in the current schema"""
+    try:
+        with open(Path(filepath), encoding='utf-8') as f:
+            return unwrap_content(json.load(f))
+    except (OSError, ValueError) as e:
+        logging.error(f"Error loading stored content {filepath}: {e}")
+        return None
@@ -0,0 +1,21 @@
+from typing import Optional
+
+THAI_DIGITS = str.maketrans('๐๑๒๓๔๕๖๗๘๙', '0123456789')
+
+# e-GP department codes are 4 digits; shorter numeric codes have lost their leading zeros
+DEPT_ID_LENGTH = 4
+
+def normalize_dept_id(dept_id: Optional[str]) -> Optional[str]:
+    """
+    Canonical form of a department ID
+    Strips whitespace, converts Thai digits and restores leading zeros of numeric codes,
+    so "307", " 0307 " and "๐๓๐๗" all become "0307". Non-numeric IDs are only stripped.
+    """
+    if dept_id is None:
+        return None
+    value = str(dept_id).strip().translate(THAI_DIGITS)
+    if not value:
+        return None
+    if value.isdigit() and len(value) < DEPT_ID_LENGTH:
+        return value.zfill(DEPT_ID_LENGTH)
+    return value
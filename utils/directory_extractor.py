@@ -0,0 +1,125 @@
+import csv
+import json
+import logging
+from concurrent.futures import ThreadPoolExecutor, as_completed
+from pathlib import Path
+from typing import Dict, List, Optional
+from utils.pdf_extractor import PDFExtractor, PDFParseError
+from utils.memory_guard import InFlightGuard
+
+CSV_COLUMNS = [
+    'file', 'success', 'error', 'page_count', 'failed_pages', 'budget_amount', 'budget_min', 'budget_max', 'bid_security',
+    'duration_years', 'duration_months', 'submission_date', 'submission_time',
+    'submission_deadline', 'contact_phone', 'contact_email', 'contact_address', 'province',
+    'delivery_location', 'delivery_province',
+    'committee', 'signatory_name', 'signatory_position', 'notice_type',
+]
+
+def find_pdfs(directory: str) -> List[Path]:
+    """Find every PDF under a directory, in a stable order"""
+    return sorted(p for p in Path(directory).rglob('*') if p.is_file() and p.suffix.lower() == '.pdf')
+
+def flatten_result(result: Dict) -> Dict:
+    """Flatten one file's extracted data into a CSV row"""
+    extracted = result['extracted'] or {}
+    budget = extracted.get('budget') or {}
+    bid_security = extracted.get('bid_security') or {}
+    duration = extracted.get('duration') or {}
+    submission = extracted.get('submission_info') or {}
+    contact = extracted.get('contact_info') or {}
+    province = extracted.get('province') or {}
+    authority = extracted.get('authority') or {}
+    delivery = extracted.get('delivery_location') or {}
+    signatory = authority.get('signatory') or {}
+    return {
+        'file': result['file'],
+        'success': result['extracted'] is not None,
+        'error': result['error'],
+        'page_count': extracted.get('page_count'),
+        'failed_pages': extracted.get('failed_pages'),
+        'budget_amount': budget.get('amount_clean'),
+        'budget_min': budget.get('min'),
+        'budget_max': budget.get('max'),
+        'bid_security': bid_security.get('amount_clean'),
+        'duration_years': duration.get('years'),
+        'duration_months': duration.get('months'),
+        'submission_date': submission.get('date'),
+        'submission_time': submission.get('time'),
+        'submission_deadline': submission.get('submission_deadline'),
+        'contact_phone': contact.get('phone'),
+        'contact_email': contact.get('email'),
+        'contact_address': contact.get('address'),
+        'province': province.get('name'),
+        'delivery_location': delivery.get('location'),
+        'delivery_province': (delivery.get('province') or {}).get('name'),
+        'committee': '; '.join(member['name'] for member in authority.get('committee') or []) or None,
+        'signatory_name': signatory.get('name'),
+        'signatory_position': signatory.get('position'),
+        'notice_type': extracted.get('notice_type'),
+    }
+
+def write_results(results: List[Dict], output_file: str, output_format: str = 'json'):
+    """Write extraction results as a JSON list or a CSV table"""
+    output_path = Path(output_file)
+    output_path.parent.mkdir(parents=True, exist_ok=True)
+    if output_format == 'csv':
+        # utf-8-sig so Excel shows Thai text correctly
+        with open(output_path, 'w', encoding='utf-8-sig', newline='') as f:
+            writer = csv.DictWriter(f, fieldnames=CSV_COLUMNS)
+            writer.writeheader()
+            for result in results:
+                writer.writerow(flatten_result(result))
+    else:
+        with open(output_path, 'w', encoding='utf-8') as f:
+            json.dump(results, f, ensure_ascii=False, indent=2, sort_keys=True, default=str)
+
+def extract_directory(directory: str, output_file: str, output_format: str = 'json',
+                      workers: int = 4, extractor: Optional[PDFExtractor] = None,
+                      max_in_flight_bytes: Optional[int] = None) -> List[Dict]:
+    """
+    Extract every PDF under a directory and write the results to a file
+    Args:
+        directory: Folder searched recursively for .pdf files; other files are skipped
+        output_file: JSON or CSV file to write
+        output_format: 'json' or 'csv'
+        workers: Number of PDFs extracted at the same time
+        extractor: Configured PDF extractor, a default extractor when omitted
+        max_in_flight_bytes: Combined size of PDFs extracted at the same time; further PDFs
+            wait for room (None for no limit)
+    Returns one result per PDF, ordered by path; error is set when the PDF could not be read at all
+    """
+    extractor = extractor or PDFExtractor()
+    pdfs = find_pdfs(directory)
+    if not pdfs:
+        logging.info(f"No PDF files found in {directory}")
+
+    guard = InFlightGuard(max_in_flight_bytes)
+
+    def extract(pdf: Path) -> Optional[Dict]:
+        with guard.hold(pdf.stat().st_size):
+            return extractor.parse_pdf(str(pdf))
+
+    results = {}
+    with ThreadPoolExecutor(max_workers=max(1, workers)) as executor:
+        futures = {executor.submit(extract, pdf): pdf for pdf in pdfs}
+        for done, future in enumerate(as_completed(futures), 1):
+            pdf = futures[future]
+            error = None
+            try:
+                extracted = future.result()
+            except PDFParseError as e:
+                extracted, error = None, str(e)
+            if extracted:
+                # The full text would dwarf the extracted fields in the output file
+                extracted = {key: value for key, value in extracted.items() if key != 'raw_text'}
+            results[pdf] = {'file': str(pdf), 'extracted': extracted, 'error': error}
+            status = "extracted" if extracted else "unreadable" if error else "no data"
+            logging.info(f"[{done}/{len(pdfs)}] {status}: {pdf}")
+
+    ordered = [results[pdf] for pdf in pdfs]
+    write_results(ordered, output_file, output_format)
+    success_count = sum(1 for result in ordered if result['extracted'])
+    logging.info(f"Extracted {success_count} of {len(ordered)} PDFs to {output_file}")
+    if guard.waits:
+        logging.info(f"{guard.waits} PDFs waited for in-flight memory to free up")
+    return ordered
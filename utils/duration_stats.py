@@ -0,0 +1,61 @@
+import math
+import random
+import threading
+from typing import Dict, Optional
+
+class DurationStats:
+    """Tracks the distribution of per-entry durations for each processing stage"""
+
+    def __init__(self, max_samples: int = 1000, seed: Optional[int] = None):
+        """
+        Args:
+            max_samples: Samples kept per stage; older samples are replaced at random
+                once full so memory stays bounded however many entries are processed
+            seed: Seed for the sample replacement, for reproducible percentiles
+        """
+        self.max_samples = max_samples
+        self._random = random.Random(seed)
+        self._samples = {}
+        self._counts = {}
+        self._maxima = {}
+        self._lock = threading.Lock()
+
+    def record(self, stage: str, seconds: float):
+        """Add a duration sample for a stage"""
+        with self._lock:
+            samples = self._samples.setdefault(stage, [])
+            count = self._counts.get(stage, 0) + 1
+            self._counts[stage] = count
+            self._maxima[stage] = max(seconds, self._maxima.get(stage, seconds))
+
+            # Reservoir sampling keeps a uniform sample of every duration seen
+            if len(samples) < self.max_samples:
+                samples.append(seconds)
+            else:
+                index = self._random.randrange(count)
+                if index < self.max_samples:
+                    samples[index] = seconds
+
+    def percentile(self, stage: str, percent: float) -> Optional[float]:
+        """Get the approximate duration below which the given percent of samples fall"""
+        with self._lock:
+            samples = sorted(self._samples.get(stage, []))
+        if not samples:
+            return None
+        rank = max(1, math.ceil(percent / 100 * len(samples)))
+        return samples[min(rank, len(samples)) - 1]
+
+    def summary(self) -> Dict[str, Dict[str, float]]:
+        """Get the count, p50, p90, p99 and max duration of every stage"""
+        with self._lock:
+            stages = {stage: (self._counts[stage], self._maxima[stage]) for stage in self._samples}
+        return {
+            stage: {
+                'count': count,
+                'p50': self.percentile(stage, 50),
+                'p90': self.percentile(stage, 90),
+                'p99': self.percentile(stage, 99),
+                'max': longest,
+            }
+            for stage, (count, longest) in stages.items()
+        }
@@ -0,0 +1,113 @@
+import html
+import logging
+import smtplib
+from datetime import datetime, timedelta, timezone
+from email.message import EmailMessage
+from typing import Dict, List, Optional
+from database.database import Database
+from utils.formatting import format_thb
+from utils.timestamps import format_display
+
+# Run statistics totalled in the summary, with their labels
+RUN_TOTALS = (
+    ('entries_fetched', 'Fetched'),
+    ('entries_processed', 'Processed'),
+    ('entries_skipped', 'Skipped'),
+    ('entries_deferred', 'Deferred'),
+    ('entries_filtered', 'Filtered'),
+    ('entries_failed', 'Failed'),
+)
+
+def build_summary(db: Database, hours: float = 24, min_budget: float = 1_000_000,
+                  limit: int = 20, now: Optional[datetime] = None) -> Dict:
+    """
+    Collect run statistics and newly extracted high-value projects for a summary
+    Args:
+        db: Open database connection
+        hours: Length of the period covered, ending now
+        min_budget: Smallest budget in baht for a project to be listed
+        limit: Most projects listed
+        now: End of the period, the current time when omitted
+    """
+    end = now or datetime.now(timezone.utc)
+    start = end - timedelta(hours=hours)
+    runs = db.get_runs_since(start)
+    return {
+        'start': start,
+        'end': end,
+        'runs': runs,
+        'failed_runs': sum(1 for run in runs if run['status'] == 'failed'),
+        'totals': {key: sum(run[key] or 0 for run in runs) for key, _ in RUN_TOTALS},
+        'projects': db.get_high_value_projects(start, min_budget, limit),
+        'min_budget': min_budget,
+    }
+
+def render_html(summary: Dict) -> str:
+    """Render a summary as an HTML email body"""
+    lines = [
+        "<html><body>",
+        f"<h2>Procurement summary {html.escape(format_display(summary['start']))} - "
+        f"{html.escape(format_display(summary['end']))}</h2>",
+        f"<p>{len(summary['runs'])} runs, {summary['failed_runs']} failed</p>",
+        "<table border=\"1\" cellpadding=\"4\" cellspacing=\"0\"><tr>",
+    ]
+    lines += [f"<th>{label}</th>" for _, label in RUN_TOTALS]
+    lines.append("</tr><tr>")
+    lines += [f"<td>{summary['totals'][key]}</td>" for key, _ in RUN_TOTALS]
+    lines.append("</tr></table>")
+
+    lines.append(f"<h3>Projects with a budget of at least {html.escape(format_thb(summary['min_budget']))}</h3>")
+    if summary['projects']:
+        lines.append("<table border=\"1\" cellpadding=\"4\" cellspacing=\"0\">"
+                     "<tr><th>Project</th><th>Budget</th><th>Submission</th><th>Province</th></tr>")
+        for project in summary['projects']:
+            submission = ' '.join(v for v in (project.get('submission_date'), project.get('submission_time')) if v)
+            lines.append(
+                f"<tr><td><a href=\"{html.escape(project['link'])}\">{html.escape(project['title'].strip())}</a></td>"
+                f"<td>{html.escape(format_thb(project['budget_amount']))}</td>"
+                f"<td>{html.escape(submission or '-')}</td>"
+                f"<td>{html.escape(project.get('province') or '-')}</td></tr>"
+            )
+        lines.append("</table>")
+    else:
+        lines.append("<p>No new projects.</p>")
+    lines.append("</body></html>")
+    return '\n'.join(lines)
+
+def send_summary(summary: Dict, host: str, sender: str, recipients: List[str], port: int = 587,
+                 username: Optional[str] = None, password: Optional[str] = None,
+                 use_tls: bool = True, smtp_class=smtplib.SMTP) -> bool:
+    """
+    Email a summary over SMTP
+    Args:
+        summary: Summary from build_summary
+        host: SMTP server host
+        sender: From address
+        recipients: To addresses
+        port: SMTP server port
+        username: SMTP login, no login when omitted
+        password: SMTP password
+        use_tls: Upgrade the connection with STARTTLS before logging in
+        smtp_class: SMTP client class, replaceable for testing
+    Returns whether the message was sent; failures are logged rather than raised
+    """
+    message = EmailMessage()
+    message['Subject'] = (f"Procurement summary: {len(summary['projects'])} projects, "
+                          f"{summary['totals']['entries_failed']} failed entries")
+    message['From'] = sender
+    message['To'] = ', '.join(recipients)
+    message.set_content("This summary is best viewed in an HTML capable mail client.")
+    message.add_alternative(render_html(summary), subtype='html')
+
+    try:
+        with smtp_class(host, port, timeout=30) as smtp:
+            if use_tls:
+                smtp.starttls()
+            if username:
+                smtp.login(username, password or '')
+            smtp.send_message(message)
+        logging.info(f"Sent summary email to {', '.join(recipients)}")
+        return True
+    except (smtplib.SMTPException, OSError) as e:
+        logging.error(f"Error sending summary email via {host}:{port}: {e}")
+        return False
@@ -0,0 +1,134 @@
+import copy
+import hashlib
+import json
+import logging
+import os
+import threading
+from collections import OrderedDict
+from pathlib import Path
+from typing import Any, Optional
+from utils.clock import Clock, SystemClock
+
+class ExtractionCache:
+    """Bounded LRU cache of extraction results with TTL eviction, optionally kept on disk between runs"""
+
+    def __init__(self, max_size: int = 128, ttl_seconds: float = 3600, clock: Optional[Clock] = None,
+                 directory: Optional[str] = None):
+        """
+        Args:
+            max_size: Most entries kept before the least recently used is evicted (0 disables caching)
+            ttl_seconds: Seconds an entry stays valid (0 for no expiry)
+            clock: Time source for entry ages, the system clock when omitted
+            directory: Folder where entries are also written so later processes can use them
+                (None to keep them in memory only); expired files are removed when the cache opens
+        """
+        self.max_size = max_size
+        self.ttl_seconds = ttl_seconds
+        self.clock = clock or SystemClock()
+        self.directory = Path(directory) if directory else None
+        self._entries = OrderedDict()
+        self._lock = threading.Lock()
+        if self.directory and self.max_size > 0:
+            self.directory.mkdir(parents=True, exist_ok=True)
+            self.prune()
+
+    def get(self, key: str) -> Optional[Any]:
+        """Return a copy of the cached value, or None if missing or expired"""
+        with self._lock:
+            entry = self._entries.get(key)
+            if entry is None:
+                return self._load(key)
+
+            stored_at, value = entry
+            if self.ttl_seconds and self.clock.monotonic() - stored_at > self.ttl_seconds:
+                del self._entries[key]
+                return None
+
+            self._entries.move_to_end(key)
+            return copy.deepcopy(value)
+
+    def put(self, key: str, value: Any):
+        """Store a value, evicting the least recently used entry past capacity"""
+        if self.max_size <= 0:
+            return
+
+        with self._lock:
+            self._remember(key, self.clock.monotonic(), copy.deepcopy(value))
+            self._save(key, value)
+
+    def clear(self):
+        """Remove all cached entries, including those on disk"""
+        with self._lock:
+            self._entries.clear()
+            if self.directory:
+                for path in self.directory.glob('*.json'):
+                    path.unlink(missing_ok=True)
+
+    def prune(self) -> int:
+        """Remove entry files on disk that have outlived the TTL"""
+        if not self.directory or not self.ttl_seconds:
+            return 0
+        removed = 0
+        for path in self.directory.glob('*.json'):
+            if self._read(path) is None:
+                removed += 1
+        if removed:
+            logging.info(f"Removed {removed} expired extraction cache entries from {self.directory}")
+        return removed
+
+    def _remember(self, key: str, stored_at: float, value: Any):
+        self._entries[key] = (stored_at, value)
+        self._entries.move_to_end(key)
+        while len(self._entries) > self.max_size:
+            self._entries.popitem(last=False)
+
+    def _path(self, key: str) -> Path:
+        # Keys hold characters that are not valid in file names everywhere
+        return self.directory / f"{hashlib.sha256(key.encode('utf-8')).hexdigest()}.json"
+
+    def _read(self, path: Path) -> Optional[dict]:
+        """Read an entry file, removing it when it is unreadable or expired"""
+        try:
+            with open(path, encoding='utf-8') as f:
+                entry = json.load(f)
+            age = self.clock.time() - entry['stored_at']
+        except FileNotFoundError:
+            return None
+        except (OSError, ValueError, KeyError, TypeError) as e:
+            logging.warning(f"Discarding unreadable extraction cache entry {path}: {e}")
+            path.unlink(missing_ok=True)
+            return None
+        if self.ttl_seconds and age > self.ttl_seconds:
+            path.unlink(missing_ok=True)
+            return None
+        entry['age'] = max(age, 0)
+        return entry
+
+    def _load(self, key: str) -> Optional[Any]:
+        """Load an entry written by this or an earlier process into memory"""
+        if not self.directory or self.max_size <= 0:
+            return None
+        entry = self._read(self._path(key))
+        if entry is None or entry.get('key') != key:
+            return None
+        # Keep the entry's remaining lifetime rather than starting it over
+        self._remember(key, self.clock.monotonic() - entry['age'], entry['value'])
+        return copy.deepcopy(entry['value'])
+
+    def _save(self, key: str, value: Any):
+        """Write an entry to disk, through a temporary file so readers never see a partial one"""
+        if not self.directory:
+            return
+        path = self._path(key)
+        temp_path = path.with_name(f"{path.name}.{threading.get_ident()}.tmp")
+        try:
+            with open(temp_path, 'w', encoding='utf-8') as f:
+                json.dump({'key': key, 'stored_at': self.clock.time(), 'value': value}, f, ensure_ascii=False)
+            os.replace(temp_path, path)
+        except (OSError, TypeError, ValueError) as e:
+            logging.warning(f"Could not write extraction cache entry {path}: {e}")
+            temp_path.unlink(missing_ok=True)
+
+    def __len__(self):
+        with self._lock:
+            return len(self._entries)
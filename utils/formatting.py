@@ -0,0 +1,4 @@
+def format_thb(amount: float) -> str:
+    """Format an amount in baht with thousands separators, e.g. 1,500,000.00 บาท"""
+    # "or 0.0" also turns -0.0 into 0.0 so zero never prints with a sign
+    return f"{(amount or 0.0):,.2f} บาท"
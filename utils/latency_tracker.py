@@ -0,0 +1,51 @@
+import logging
+import threading
+from typing import Dict, Optional
+from urllib.parse import urlparse
+
+class LatencyTracker:
+    """Tracks an exponential moving average of request latency per host"""
+
+    def __init__(self, alpha: float = 0.2, warn_threshold: float = 10.0):
+        """
+        Args:
+            alpha: Weight of the newest sample (0-1); higher reacts faster
+            warn_threshold: EMA latency in seconds above which a host is reported as slow
+        """
+        self.alpha = alpha
+        self.warn_threshold = warn_threshold
+        self._averages = {}
+        self._slow_hosts = set()
+        self._lock = threading.Lock()
+
+    def record(self, url_or_host: str, seconds: float) -> float:
+        """Add a latency sample and return the host's updated average"""
+        host = urlparse(url_or_host).netloc or url_or_host
+        with self._lock:
+            previous = self._averages.get(host)
+            average = seconds if previous is None else self.alpha * seconds + (1 - self.alpha) * previous
+            self._averages[host] = average
+
+            # Warn once when a host becomes slow, and again only after it recovers
+            if average > self.warn_threshold and host not in self._slow_hosts:
+                self._slow_hosts.add(host)
+                logging.warning(f"Average latency for {host} is {average:.2f}s (threshold {self.warn_threshold:.2f}s)")
+            elif average <= self.warn_threshold and host in self._slow_hosts:
+                self._slow_hosts.discard(host)
+                logging.info(f"Average latency for {host} recovered to {average:.2f}s")
+        return average
+
+    def get(self, host: str) -> Optional[float]:
+        """Get the current average latency for a host"""
+        with self._lock:
+            return self._averages.get(host)
+
+    def is_slow(self, host: str) -> bool:
+        """Check whether a host's average latency is above the threshold"""
+        with self._lock:
+            return host in self._slow_hosts
+
+    def snapshot(self) -> Dict[str, float]:
+        """Get the current average latency of every host"""
+        with self._lock:
+            return dict(self._averages)
@@ -0,0 +1,57 @@
+import logging
+import threading
+from contextlib import contextmanager
+from typing import Dict, Optional
+
+class InFlightGuard:
+    """
+    Coarse ceiling on the bytes of documents being extracted at the same time, estimated from file sizes
+    A document waits while admitting it would pass the ceiling and is admitted as others finish;
+    with nothing else in flight a document is always admitted, so an oversized file runs alone
+    Used by extract-dir, which extracts several PDFs at once on its workers, and by PDFProcessor,
+    where a timed-out extraction keeps running in its abandoned thread while the next one starts
+    """
+
+    def __init__(self, max_bytes: Optional[int] = None):
+        """
+        Args:
+            max_bytes: Bytes of documents allowed in flight at once (None for no limit)
+        """
+        self.max_bytes = max_bytes
+        self.in_flight = 0
+        self.waits = 0
+        self._condition = threading.Condition()
+
+    def fits(self, size: int) -> bool:
+        """Check whether a document of the given size can start now"""
+        return not self.max_bytes or self.in_flight == 0 or self.in_flight + size <= self.max_bytes
+
+    def acquire(self, size: int):
+        """Wait until a document of the given size fits, then count it as in flight"""
+        with self._condition:
+            if not self.fits(size):
+                self.waits += 1
+                logging.info(f"Deferring extraction of {size} bytes: {self.in_flight} of "
+                             f"{self.max_bytes} bytes already in flight")
+                self._condition.wait_for(lambda: self.fits(size))
+            self.in_flight += size
+
+    def release(self, size: int):
+        """Stop counting a finished document and wake documents waiting for room"""
+        with self._condition:
+            self.in_flight -= size
+            self._condition.notify_all()
+
+    @contextmanager
+    def hold(self, size: int):
+        """Count a document as in flight for the duration of a with block"""
+        self.acquire(size)
+        try:
+            yield
+        finally:
+            self.release(size)
+
+    def snapshot(self) -> Dict[str, Optional[int]]:
+        """Current in-flight estimate, for metrics"""
+        with self._condition:
+            return {'in_flight_bytes': self.in_flight, 'max_bytes': self.max_bytes, 'waits': self.waits}
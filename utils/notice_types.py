@@ -0,0 +1,53 @@
+from typing import Iterator, Optional
+
+AMENDMENT = 'amendment'
+CANCELLATION = 'cancellation'
+
+# Tender lifecycle statuses; cancelled is final
+OPEN = 'open'
+AMENDED = 'amended'
+CANCELLED = 'cancelled'
+CLOSED = 'closed'
+TENDER_STATUSES = (OPEN, AMENDED, CANCELLED, CLOSED)
+ACTIVE_STATUSES = (OPEN, AMENDED)
+
+# Status an original announcement moves to when a notice about it arrives
+NOTICE_STATUS = {AMENDMENT: AMENDED, CANCELLATION: CANCELLED}
+
+# Phrases a title or subject line starts with when the notice changes or cancels an earlier
+# announcement rather than starting a tender; tender terms routinely mention cancelling or
+# amending elsewhere, so the phrases only count at the start
+CANCELLATION_CUES = ('ประกาศยกเลิก', 'ยกเลิกประกาศ', 'ยกเลิกการ', 'ยกเลิกประกวดราคา', 'ยกเลิกสอบราคา',
+                     'ยกเลิกโครงการ', 'notice of cancellation', 'cancellation of', 'cancelled:', 'canceled:')
+AMENDMENT_CUES = ('ประกาศแก้ไข', 'แก้ไขประกาศ', 'แก้ไขเพิ่มเติมประกาศ', 'ประกาศฉบับแก้ไข',
+                  'notice of amendment', 'amendment to', 'amendment no', 'corrigendum')
+
+# Word that opens the subject line of a Thai announcement heading ("ประกาศ ... เรื่อง ยกเลิกประกาศ...")
+SUBJECT_MARKER = 'เรื่อง'
+
+def notice_headings(text: str) -> Iterator[str]:
+    """The starts of the text and of each subject line in it, compacted and lowercased"""
+    lowered = ' '.join(text.split()).lower()
+    yield lowered
+    parts = lowered.split(SUBJECT_MARKER)
+    for part in parts[1:]:
+        yield part.lstrip(' :')
+
+def starts_with_cue(heading: str, cues) -> bool:
+    """Check whether a heading starts with one of the cues; spacing of Thai headings varies, so spaces are ignored"""
+    compact = heading.lstrip(' [(').replace(' ', '')
+    return any(compact.startswith(cue.replace(' ', '')) for cue in cues)
+
+def classify_notice(text: Optional[str]) -> Optional[str]:
+    """
+    Classify an announcement title or document heading as an amendment or cancellation
+    Returns None for an ordinary announcement; a cancelled amendment counts as a cancellation
+    """
+    if not text:
+        return None
+    headings = list(notice_headings(text))
+    if any(starts_with_cue(heading, CANCELLATION_CUES) for heading in headings):
+        return CANCELLATION
+    if any(starts_with_cue(heading, AMENDMENT_CUES) for heading in headings):
+        return AMENDMENT
+    return None
@@ -1,117 +1,518 @@
 import logging
 import asyncio
 import aiohttp
+from aiohttp.abc import AbstractResolver
+import hashlib
 import os
 import ssl
+import ipaddress
+import socket
 from pathlib import Path
-from typing import List, Dict, Optional
+from typing import List, Dict, Optional, Tuple
 import re
-from urllib.parse import unquote
+import zipfile
+from datetime import timezone
+from email.utils import parsedate_to_datetime
+from urllib.parse import unquote, urljoin, urlparse
+from utils.latency_tracker import LatencyTracker
+from utils.clock import Clock, SystemClock
+
+# Some e-GP links return a ZIP bundle instead of a bare PDF
+ZIP_MAGIC = b'PK\x03\x04'
+
+# Statuses worth retrying: rate limiting and server-side failures; other 4xx responses never succeed on retry
+DEFAULT_RETRY_STATUSES = (429, 500, 502, 503, 504)
+
+# Redirects are followed by hand so the host of every hop is checked
+REDIRECT_STATUSES = (301, 302, 303, 307, 308)
+
+def is_public_address(value: str) -> bool:
+    """Check whether an IP address is publicly routable (not private, loopback, link-local or reserved)"""
+    address = ipaddress.ip_address(value.split('%')[0])
+    return not (address.is_private or address.is_loopback or address.is_link_local or
+                address.is_reserved or address.is_multicast or address.is_unspecified)
+
+class PublicAddressResolver(AbstractResolver):
+    """
+    Resolver that only hands the connector public addresses
+    The connection goes to an address checked here, so a host cannot be re-pointed
+    at an internal address between the host check and the connect
+    """
+
+    def __init__(self, resolver: Optional[AbstractResolver] = None):
+        self.resolver = resolver or aiohttp.ThreadedResolver()
+
+    async def resolve(self, host: str, port: int = 0, family: int = socket.AF_INET) -> List[Dict]:
+        addresses = await self.resolver.resolve(host, port, family)
+        public = [address for address in addresses if is_public_address(address['host'])]
+        if not public:
+            raise OSError(f"host {host} resolves only to non-public addresses")
+        return public
+
+    async def close(self):
+        await self.resolver.close()
 
 class PDFDownloader:
-    def __init__(self, output_dir: str = "data/project_docs"):
+    def __init__(self, output_dir: str = "data/project_docs", session: Optional[aiohttp.ClientSession] = None,
+                 max_retries: int = 3, retry_delay: float = 5, max_retry_after: float = 300,
+                 max_total_bytes: Optional[int] = None, orphan_max_age: float = 3600,
+                 max_file_bytes: int = 100 * 1024 * 1024,
+                 latency_tracker: Optional[LatencyTracker] = None,
+                 max_connections_per_host: int = 4, keepalive_timeout: float = 30,
+                 clock: Optional[Clock] = None,
+                 allowed_hosts: Optional[List[str]] = None, denied_hosts: Optional[List[str]] = None,
+                 block_private_addresses: bool = True,
+                 retry_statuses: Tuple[int, ...] = DEFAULT_RETRY_STATUSES, retry_network_errors: bool = True,
+                 max_redirects: int = 5):
+        """
+        Args:
+            output_dir: Directory where project PDFs are saved
+            session: HTTP session to download with; batches open a shared pooled session when omitted
+            max_retries: Retries allowed for a retryable status or network error
+            retry_delay: Seconds to wait when the server gives no Retry-After
+            max_retry_after: Longest Retry-After wait honored, in seconds
+            max_total_bytes: Bytes that may be downloaded per run before new downloads are deferred
+            orphan_max_age: Seconds after which a leftover partial download is removed
+            max_file_bytes: Largest file accepted, whether downloaded directly or extracted from a ZIP archive
+            latency_tracker: Per-host latency averages to update, a new tracker when omitted
+            max_connections_per_host: Connections kept open to a single host
+            keepalive_timeout: Seconds an idle connection is kept for reuse
+            clock: Time source for retry waits, latency and file ages, the system clock when omitted
+            allowed_hosts: Hosts (and their subdomains) PDFs may be downloaded from; any host when omitted
+            denied_hosts: Hosts (and their subdomains) PDFs are never downloaded from
+            block_private_addresses: Refuse hosts that resolve to private, loopback or link-local addresses
+            retry_statuses: HTTP statuses that are retried, honoring any Retry-After header
+            retry_network_errors: Retry connection failures and timeouts
+            max_redirects: Redirects followed per download, each to a host that passes the host checks
+        """
         self.output_dir = Path(output_dir)
         self.output_dir.mkdir(parents=True, exist_ok=True)
+        self.session = session
+        self.max_retries = max_retries
+        self.retry_delay = retry_delay
+        self.max_retry_after = max_retry_after
+        self.max_total_bytes = max_total_bytes
+        self.bytes_downloaded = 0
+        # Set once a file announced a size larger than the remaining budget
+        self.budget_reached = False
+        self.orphan_max_age = orphan_max_age
+        self.max_file_bytes = max_file_bytes
+        self.latency_tracker = latency_tracker or LatencyTracker()
+        self.active_temp_files = set()
+        self.max_connections_per_host = max_connections_per_host
+        self.keepalive_timeout = keepalive_timeout
+        self.owns_session = False
+        self.clock = clock or SystemClock()
+        self.allowed_hosts = [h.lower().strip('.') for h in (allowed_hosts or [])]
+        self.denied_hosts = [h.lower().strip('.') for h in (denied_hosts or [])]
+        self.block_private_addresses = block_private_addresses
+        self.retry_statuses = set(retry_statuses)
+        self.retry_network_errors = retry_network_errors
+        self.max_redirects = max_redirects
+        # Final error of each URL that still failed after every retry
+        self.exhausted_downloads = {}
+        self.last_error = None
+
+    def create_session(self) -> aiohttp.ClientSession:
+        """
+        Create an HTTP session whose connections are pooled and kept alive between requests
+        aiohttp only speaks HTTP/1.1, so connections are reused but requests are not multiplexed (no HTTP/2)
+        """
+        # SSL context that skips verification
+        ssl_context = ssl.create_default_context()
+        ssl_context.check_hostname = False
+        ssl_context.verify_mode = ssl.CERT_NONE
+
+        connector = aiohttp.TCPConnector(
+            ssl=ssl_context,
+            limit_per_host=self.max_connections_per_host,
+            keepalive_timeout=self.keepalive_timeout,
+            resolver=PublicAddressResolver() if self.block_private_addresses else None
+        )
+        return aiohttp.ClientSession(connector=connector)
+
+    async def __aenter__(self):
+        """Open a shared session for a batch of downloads"""
+        if self.session is None:
+            self.session = self.create_session()
+            self.owns_session = True
+        return self
+
+    async def __aexit__(self, exc_type, exc_val, exc_tb):
+        """Close the shared session if this downloader opened it"""
+        if self.owns_session:
+            await self.session.close()
+            self.session = None
+            self.owns_session = False
+
+    def sweep_orphans(self) -> int:
+        """Remove partial downloads left behind by interrupted runs"""
+        removed = 0
+        cutoff = self.clock.time() - self.orphan_max_age
+        for temp_file in self.output_dir.glob('*/*.part'):
+            if temp_file in self.active_temp_files:
+                continue
+            try:
+                if temp_file.stat().st_mtime < cutoff:
+                    temp_file.unlink()
+                    removed += 1
+            except OSError as e:
+                logging.warning(f"Could not remove orphaned download {temp_file}: {e}")
+        if removed:
+            logging.info(f"Removed {removed} orphaned partial downloads")
+        return removed
+
+    def host_matches(self, host: str, patterns: List[str]) -> bool:
+        """Check whether a host is one of the patterns or a subdomain of one"""
+        return any(host == pattern or host.endswith('.' + pattern) for pattern in patterns)
+
+    async def check_host(self, url: str) -> Optional[str]:
+        """Return why a URL's host may not be downloaded from, or None when it is allowed"""
+        parsed = urlparse(url)
+        host = (parsed.hostname or '').lower()
+        if parsed.scheme not in ('http', 'https') or not host:
+            return f"unsupported URL: {url}"
+        if self.host_matches(host, self.denied_hosts):
+            return f"host {host} is denied"
+        if self.allowed_hosts and not self.host_matches(host, self.allowed_hosts):
+            return f"host {host} is not in the allowed hosts"
+
+        if self.block_private_addresses:
+            try:
+                infos = await asyncio.get_running_loop().getaddrinfo(host, parsed.port or None)
+            except socket.gaierror as e:
+                return f"host {host} could not be resolved: {e}"
+            for info in infos:
+                address = info[4][0]
+                if not is_public_address(address):
+                    return f"host {host} resolves to non-public address {address.split('%')[0]}"
+        return None
+
+    def reset_download_budget(self):
+        """Start a new run with an unused download budget"""
+        self.bytes_downloaded = 0
+        self.budget_reached = False
+
+    def budget_exhausted(self) -> bool:
+        """Check whether this run has used up its download budget"""
+        return bool(self.max_total_bytes) and (self.budget_reached or self.bytes_downloaded >= self.max_total_bytes)
+
+    def content_length(self, response) -> Optional[int]:
+        """Get the body size a response announces, or None when it gives none"""
+        try:
+            return int(response.headers.get('Content-Length'))
+        except (TypeError, ValueError):
+            return None
+        
+    def get_filepath(self, url: str, project_id: str) -> Path:
+        """Get the path a project's PDF is saved to"""
+        # Extract filename from URL or use project_id if not available
+        filename = unquote(url.split('/')[-1])
+        if not filename.endswith('.pdf'):
+            filename = f"{project_id}.pdf"
+        
+        # Clean filename of invalid characters
+        filename = re.sub(r'[<>:"/\\|?*]', '_', filename)
+        return self.output_dir / project_id / filename
         
     async def download_pdf(self, url: str, project_id: str) -> Optional[str]:
         """Download a single PDF file"""
+        result = await self.download_pdf_result(url, project_id)
+        return result['path'] if result else None
+
+    async def download_pdf_result(self, url: str, project_id: str) -> Optional[Dict]:
+        """
+        Download a single PDF file and describe what was downloaded
+        Returns the saved path, final URL after redirects, size, content type, ETag,
+        Last-Modified and SHA-256 checksum, or None when the download failed.
+        Response fields are None for a file that was already downloaded.
+        """
         try:
-            # Create project directory
-            project_dir = self.output_dir / project_id
-            project_dir.mkdir(exist_ok=True)
-            
-            # Extract filename from URL or use project_id if not available
-            filename = unquote(url.split('/')[-1])
-            if not filename.endswith('.pdf'):
-                filename = f"{project_id}.pdf"
-            
-            # Clean filename of invalid characters
-            filename = re.sub(r'[<>:"/\\|?*]', '_', filename)
-            filepath = project_dir / filename
-            
+            filepath = self.get_filepath(url, project_id)
+
             # Skip if file already exists
             if filepath.exists():
                 logging.info(f"File already exists: {filepath}")
-                return str(filepath)
+                return self.download_result(filepath)
 
-            # Set up browser-like headers
-            headers = {
-                'User-Agent': 'Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36',
-                'Accept': 'text/html,application/xhtml+xml,application/xml,application/pdf',
-                'Accept-Language': 'en-US,en;q=0.5,th;q=0.3',
-                'Connection': 'keep-alive',
-            }
+            if self.budget_exhausted():
+                logging.warning(f"Download budget exhausted, deferring: {url}")
+                return None
 
-            # SSL context that skips verification
-            ssl_context = ssl.create_default_context()
-            ssl_context.check_hostname = False
-            ssl_context.verify_mode = ssl.CERT_NONE
+            # Links come from the feed, so never let one point the downloader at internal hosts
+            rejection = await self.check_host(url)
+            if rejection:
+                logging.error(f"Refusing to download {url}: {rejection}")
+                return None
 
-            connector = aiohttp.TCPConnector(ssl=ssl_context)
+            # Only create the project directory once the file is actually going to be fetched
+            filepath.parent.mkdir(exist_ok=True)
+            if self.session is not None:
+                return await self.fetch_pdf(self.session, url, filepath)
 
-            async with aiohttp.ClientSession(connector=connector) as session:
-                try:
-                    logging.info(f"Attempting to download from: {url}")
-                    async with session.get(url, headers=headers, allow_redirects=True) as response:
-                        if response.status != 200:
-                            logging.error(f"Failed download: HTTP {response.status}")
-                            return None
-
-                        # Log response details for debugging
-                        logging.info(f"Response headers: {dict(response.headers)}")
-                        
-                        # Download the file
-                        with open(filepath, 'wb') as f:
-                            async for chunk in response.content.iter_chunked(8192):
-                                f.write(chunk)
-                        
-                        # Verify the file is a PDF
-                        if os.path.getsize(filepath) > 0:
-                            with open(filepath, 'rb') as f:
-                                if f.read(4).startswith(b'%PDF'):
-                                    logging.info(f"Successfully downloaded: {filepath}")
-                                    return str(filepath)
-                                else:
-                                    os.remove(filepath)
-                                    logging.error("Downloaded file is not a valid PDF")
-                                    return None
-                        else:
-                            os.remove(filepath)
-                            logging.error("Downloaded file is empty")
-                            return None
-                            
-                except Exception as e:
-                    logging.error(f"Error during download attempt: {str(e)}")
-                    return None
+            async with self.create_session() as session:
+                return await self.fetch_pdf(session, url, filepath)
 
         except Exception as e:
             logging.error(f"Error in download process: {str(e)}")
             return None
+
+    def download_result(self, filepath: Path, response=None) -> Dict:
+        """Describe a saved PDF and, when it was just fetched, the response it came from"""
+        checksum = hashlib.sha256()
+        with open(filepath, 'rb') as f:
+            for chunk in iter(lambda: f.read(65536), b''):
+                checksum.update(chunk)
+        headers = response.headers if response is not None else {}
+        return {
+            'path': str(filepath),
+            'final_url': str(response.url) if response is not None else None,
+            'size': os.path.getsize(filepath),
+            'content_type': headers.get('Content-Type'),
+            'etag': headers.get('ETag'),
+            'last_modified': headers.get('Last-Modified'),
+            'checksum': checksum.hexdigest(),
+        }
+
+    async def fetch_pdf(self, session: aiohttp.ClientSession, url: str, filepath: Path) -> Optional[Dict]:
+        """Fetch a URL with the given session and save it if it is a PDF, retrying retryable failures"""
+        attempt = 0
+        while True:
+            result, retry_after = await self.fetch_once(session, url, filepath)
+            if retry_after is None:
+                return result
+            if attempt >= self.max_retries:
+                logging.error(f"Giving up on {url} after {attempt + 1} attempts")
+                self.exhausted_downloads[url] = {'error': self.last_error, 'attempts': attempt + 1}
+                return result
+
+            attempt += 1
+            logging.warning(f"Retrying {url} in {retry_after:.1f}s (attempt {attempt} of {self.max_retries})")
+            await self.clock.sleep(retry_after)
+
+    async def fetch_once(self, session: aiohttp.ClientSession, url: str, filepath: Path) -> Tuple[Optional[Dict], Optional[float]]:
+        """
+        Make a single download attempt
+        Returns the download result (or None) and the seconds to wait before retrying,
+        or None when the attempt should not be retried
+        """
+        # Set up browser-like headers
+        headers = {
+            'User-Agent': 'Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36',
+            'Accept': 'text/html,application/xhtml+xml,application/xml,application/pdf',
+            'Accept-Language': 'en-US,en;q=0.5,th;q=0.3',
+            'Connection': 'keep-alive',
+        }
+
+        try:
+            current_url = url
+            for _ in range(self.max_redirects + 1):
+                logging.info(f"Attempting to download from: {current_url}")
+                started = self.clock.monotonic()
+                async with session.get(current_url, headers=headers, allow_redirects=False) as response:
+                    self.latency_tracker.record(current_url, self.clock.monotonic() - started)
+                    if response.status not in REDIRECT_STATUSES:
+                        return await self.save_response(response, filepath)
+                    location = response.headers.get('Location')
+
+                if not location:
+                    logging.error(f"Redirect from {current_url} has no Location header")
+                    return None, None
+                # A feed link to an allowed host must not be able to bounce the download to an internal one
+                next_url = urljoin(current_url, location)
+                rejection = await self.check_host(next_url)
+                if rejection:
+                    self.last_error = f"Refusing redirect to {next_url}: {rejection}"
+                    logging.error(self.last_error)
+                    return None, None
+                current_url = next_url
+
+            logging.error(f"Too many redirects downloading {url} (limit {self.max_redirects})")
+            return None, None
+
+        except (aiohttp.ClientError, asyncio.TimeoutError) as e:
+            self.last_error = f"Network error: {str(e) or type(e).__name__}"
+            logging.error(f"{self.last_error} during download attempt")
+            return None, self.retry_delay if self.retry_network_errors else None
+        except Exception as e:
+            logging.error(f"Error during download attempt: {str(e)}")
+            return None, None
+
+    async def save_response(self, response, filepath: Path) -> Tuple[Optional[Dict], Optional[float]]:
+        """Save a final (non-redirect) response if it is a PDF; returns the same as fetch_once"""
+        if response.status in self.retry_statuses:
+            self.last_error = f"HTTP {response.status}"
+            logging.error(f"Failed download: HTTP {response.status}")
+            return None, self.parse_retry_after(response.headers.get('Retry-After'))
+
+        if response.status != 200:
+            logging.error(f"Failed download: HTTP {response.status}")
+            return None, None
+
+        # Log response details for debugging
+        logging.info(f"Response headers: {dict(response.headers)}")
+
+        content_length = self.content_length(response)
+        if (self.max_total_bytes and content_length is not None and
+                self.bytes_downloaded + content_length > self.max_total_bytes):
+            logging.warning(f"File of {content_length} bytes exceeds the remaining download budget, deferring")
+            self.budget_reached = True
+            return None, None
+        if content_length is not None and content_length > self.max_file_bytes:
+            logging.error(f"File is too large: {content_length} bytes (limit {self.max_file_bytes})")
+            return None, None
+
+        # Download to a temporary file so an interrupted download is never mistaken for a complete one
+        temp_path = filepath.with_name(filepath.name + '.part')
+        self.active_temp_files.add(temp_path)
+        try:
+            written = 0
+            with open(temp_path, 'wb') as f:
+                async for chunk in response.content.iter_chunked(8192):
+                    written += len(chunk)
+                    if written > self.max_file_bytes:
+                        logging.error(f"File exceeds {self.max_file_bytes} bytes, abandoning download")
+                        return None, None
+                    # Counted as it arrives, since chunked responses announce no size
+                    self.bytes_downloaded += len(chunk)
+                    if self.max_total_bytes and self.bytes_downloaded > self.max_total_bytes:
+                        logging.warning(f"Download budget used up partway through {response.url}, deferring")
+                        return None, None
+                    f.write(chunk)
+
+            # Verify the file is a PDF
+            if os.path.getsize(temp_path) > 0:
+                with open(temp_path, 'rb') as f:
+                    magic = f.read(4)
+                if magic.startswith(b'%PDF'):
+                    os.replace(temp_path, filepath)
+                    logging.info(f"Successfully downloaded: {filepath}")
+                    return self.download_result(filepath, response), None
+                elif magic.startswith(ZIP_MAGIC):
+                    if not self.extract_pdf_from_zip(temp_path, filepath):
+                        return None, None
+                    logging.info(f"Successfully downloaded and unpacked: {filepath}")
+                    return self.download_result(filepath, response), None
+                else:
+                    logging.error("Downloaded file is not a valid PDF")
+                    return None, None
+            else:
+                logging.error("Downloaded file is empty")
+                return None, None
+        finally:
+            self.active_temp_files.discard(temp_path)
+            if temp_path.exists():
+                os.remove(temp_path)
+
+    def extract_pdf_from_zip(self, archive_path: Path, filepath: Path) -> bool:
+        """Extract the largest PDF in a ZIP archive to filepath"""
+        try:
+            with zipfile.ZipFile(archive_path) as archive:
+                members = [
+                    m for m in archive.infolist()
+                    if not m.is_dir() and m.filename.lower().endswith('.pdf')
+                ]
+                if not members:
+                    logging.error("ZIP archive does not contain a PDF")
+                    return False
+
+                member = max(members, key=lambda m: m.file_size)
+                if member.file_size > self.max_file_bytes:
+                    logging.error(f"PDF in ZIP archive is too large: {member.file_size} bytes")
+                    return False
+
+                temp_path = filepath.with_name(filepath.name + '.unzip.part')
+                self.active_temp_files.add(temp_path)
+                try:
+                    # Count while copying; the size in the ZIP header is not trustworthy
+                    written = 0
+                    with archive.open(member) as source, open(temp_path, 'wb') as target:
+                        while True:
+                            chunk = source.read(65536)
+                            if not chunk:
+                                break
+                            written += len(chunk)
+                            if written > self.max_file_bytes:
+                                logging.error(f"PDF in ZIP archive exceeds {self.max_file_bytes} bytes")
+                                return False
+                            target.write(chunk)
+
+                    with open(temp_path, 'rb') as f:
+                        if not f.read(4).startswith(b'%PDF'):
+                            logging.error(f"{member.filename} in ZIP archive is not a valid PDF")
+                            return False
+
+                    os.replace(temp_path, filepath)
+                    logging.info(f"Extracted {member.filename} from ZIP archive")
+                    return True
+                finally:
+                    self.active_temp_files.discard(temp_path)
+                    if temp_path.exists():
+                        os.remove(temp_path)
+
+        except zipfile.BadZipFile as e:
+            logging.error(f"Downloaded ZIP archive is invalid: {e}")
+            return False
+
+    def parse_retry_after(self, value: Optional[str]) -> float:
+        """Convert a Retry-After header (seconds or HTTP date) into a wait in seconds"""
+        if not value:
+            return self.retry_delay
+
+        value = value.strip()
+        try:
+            if value.isdigit():
+                delay = float(value)
+            else:
+                retry_at = parsedate_to_datetime(value)
+                if retry_at.tzinfo is None:
+                    retry_at = retry_at.replace(tzinfo=timezone.utc)
+                delay = (retry_at - self.clock.now(timezone.utc)).total_seconds()
+        except (TypeError, ValueError):
+            logging.warning(f"Could not parse Retry-After header: {value}")
+            return self.retry_delay
+
+        return min(max(delay, 0), self.max_retry_after)
             
     async def download_batch(self, announcements: List[Dict]) -> List[Dict]:
         """Download PDFs for multiple announcements"""
         results = []
+        self.reset_download_budget()
+        self.sweep_orphans()
         
-        for announcement in announcements:
-            project_id = announcement.get('project_id', 'unknown')
-            url = announcement.get('link')
-            
-            if not url:
-                logging.warning(f"No URL found for project {project_id}")
-                continue
+        async with self:
+            for announcement in announcements:
+                project_id = announcement.get('project_id', 'unknown')
+                url = announcement.get('link')
                 
-            filepath = await self.download_pdf(url, project_id)
-            
-            results.append({
-                'project_id': project_id,
-                'url': url,
-                'filepath': filepath,
-                'success': filepath is not None
-            })
+                if not url:
+                    logging.warning(f"No URL found for project {project_id}")
+                    continue
+                    
+                result = await self.download_pdf_result(url, project_id)
+                filepath = result['path'] if result else None
+                
+                results.append({
+                    'project_id': project_id,
+                    'url': url,
+                    'filepath': filepath,
+                    'success': filepath is not None,
+                    'deferred': filepath is None and self.budget_exhausted(),
+                    'download': result
+                })
             
+        self.log_latency()
         return results
 
-def download_pdfs(announcements: List[Dict]) -> List[Dict]:
+    def log_latency(self):
+        """Log the average response latency of each host contacted"""
+        for host, average in sorted(self.latency_tracker.snapshot().items()):
+            logging.info(f"Average latency for {host}: {average:.2f}s")
+
+def download_pdfs(announcements: List[Dict], session: Optional[aiohttp.ClientSession] = None,
+                  max_total_bytes: Optional[int] = None, allowed_hosts: Optional[List[str]] = None,
+                  denied_hosts: Optional[List[str]] = None) -> List[Dict]:
     """Synchronous wrapper for PDF downloads"""
-    downloader = PDFDownloader()
+    downloader = PDFDownloader(session=session, max_total_bytes=max_total_bytes,
+                               allowed_hosts=allowed_hosts, denied_hosts=denied_hosts)
     return asyncio.run(downloader.download_batch(announcements))
\ No newline at end of file
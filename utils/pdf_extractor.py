@@ -1,10 +1,152 @@
-import PyPDF2
+import hashlib
+import importlib
+import logging
 import re
+import sys
 from pathlib import Path
+from urllib.parse import urlparse
+
+# Add parent directory to Python path
+sys.path.append(str(Path(__file__).parent.parent))
+
+from utils.extraction_cache import ExtractionCache
+from utils.text_engines import get_engine
+from utils.formatting import format_thb
+from utils.provinces import classify_province
+from utils.notice_types import classify_notice
+from utils.thai_dates import parse_thai_date, parse_thai_date_range
+
+class PDFParseError(Exception):
+    """Raised when a PDF could not be read at all, as opposed to one read without usable data"""
+
+    def __init__(self, pdf_path: str, cause: Exception):
+        super().__init__(f"Error parsing PDF {pdf_path}: {cause}")
+        self.pdf_path = pdf_path
+
+# Phrases that introduce the agency's postal address
+DEFAULT_ADDRESS_CUES = ('ที่อยู่', 'สถานที่ติดต่อ', 'ติดต่อ')
+
+# Phrases that introduce where goods are delivered or the work is carried out
+DEFAULT_DELIVERY_CUES = ('สถานที่ส่งมอบ', 'สถานที่ดำเนินการ', 'สถานที่ปฏิบัติงาน', 'สถานที่ก่อสร้าง')
+
+# Phrases that end a delivery location and start its deadline or conditions
+DELIVERY_LOCATION_ENDS = ('ภายใน', 'กำหนดส่งมอบ', 'ระยะเวลา', 'โดยผู้', 'ทั้งนี้')
+
+# Field patterns per document language; the amount is the pattern's last matched group
+# (budget_range captures the lower and upper bound)
+PATTERNS = {
+    'th': {
+        'budget': r'([\d,]+\.?\d*)\s*บาท',
+        'budget_range': r'ตั้งแต่\s*([\d,]+\.?\d*)\s*(?:บาท)?\s*(?:ถึง|จนถึง|-|–)\s*([\d,]+\.?\d*)\s*บาท',
+        'bid_security': r'หลักประกัน(?:การ)?เสนอราคา[^\d\n]{0,80}?([\d,]+\.?\d*)\s*บาท',
+        'years': r'ระยะเวลา\s*(\d+)\s*ปี',
+        'months': r'\((\d+)\s*เดือน\)',
+        'date': r'วันที่\s*(\d+.*\d{4})',
+        'time': r'(\d{2}[:\.]\d{2})\s*น',
+        'phone': r'โทรศัพท์.*?(\d[\d\-]+)',
+    },
+    'en': {
+        'budget': r'(?i)(?:(?:THB|฿)\s*([\d,]+(?:\.\d+)?)|([\d,]+(?:\.\d+)?)\s*(?:baht|THB)\b)',
+        'budget_range': (r'(?i)(?:from|between)\s+(?:THB|฿)?\s*([\d,]+(?:\.\d+)?)\s*(?:baht|THB)?\s*'
+                         r'(?:to|and|-|–)\s*(?:THB|฿)?\s*([\d,]+(?:\.\d+)?)\s*(?:baht|THB)\b'),
+        'bid_security': (r'(?i)bid\s+(?:security|bond|guarantee)[^\d\n]{0,80}?'
+                         r'(?:(?:THB|฿)\s*([\d,]+(?:\.\d+)?)|([\d,]+(?:\.\d+)?)\s*(?:baht|THB)\b)'),
+        'years': r'(?i)(?:period|duration|term)\D{0,30}?(\d+)\s*years?\b',
+        'months': r'(?i)(\d+)\s*months?\b',
+        'date': (r'(?i)(?:deadline|submission|submit)[^\n]{0,80}?'
+                 r'(\d{1,2}(?:st|nd|rd|th)?\s+[a-z]+\.?\s+\d{4}|[a-z]+\.?\s+\d{1,2},?\s+\d{4}|\d{1,2}/\d{1,2}/\d{4})'),
+        'time': r'(?i)(\d{1,2}[:.]\d{2})\s*(?:hrs?\b|hours\b|a\.?m\.?|p\.?m\.?)',
+        'phone': r'(?i)(?:tel|telephone|phone)\.?\s*(?:no\.?)?\s*:?\s*(\+?\d[\d\- ]{5,}\d)',
+    },
+}
+
+LANGUAGES = ('auto', 'th', 'en', 'both')
+
+# Characters of the previous page searched again with each new page while streaming,
+# so a field split across a page break is still found
+STREAMING_OVERLAP = 300
+
+# Modules whose code decides what is read from a document; the cache key covers all of them,
+# so a results cache that outlives the process never serves results of older rules
+RULE_MODULES = ('utils.pdf_extractor', 'utils.text_engines', 'utils.thai_dates', 'utils.provinces',
+                'utils.notice_types')
+
+# Where the pipeline commands keep extraction results between runs
+DEFAULT_CACHE_DIR = 'data/extraction_cache'
+
+def rule_module_source(name):
+    """Contents of a rule module's file: its source, or its compiled code when installed without source"""
+    return Path(importlib.import_module(name).__file__).read_bytes()
+
+# Name prefixes that start a person's name in committee lists and signatory blocks
+NAME_TITLES = ('ว่าที่ร้อยตรี', 'ว่าที่ ร.ต.', 'นางสาว', 'น.ส.', 'นาย', 'นาง', 'ดร.', 'ผศ.', 'รศ.', 'ศ.')
+
+# Committee roles, longest first so "กรรมการและเลขานุการ" is not read as "กรรมการ"
+COMMITTEE_ROLES = ('ประธานกรรมการ', 'กรรมการและเลขานุการ', 'เลขานุการ', 'กรรมการ')
 
 class PDFExtractor:
-    def __init__(self):
+    def __init__(self, cache_size=128, cache_ttl=3600, engine='pypdf2', min_text_length=100,
+                 max_failed_page_ratio=0.5, address_cues=DEFAULT_ADDRESS_CUES, streaming=False,
+                 language='auto', delivery_cues=DEFAULT_DELIVERY_CUES, clock=None, cache_dir=None):
+        """
+        Args:
+            cache_size: Maximum number of extraction results kept in memory (0 disables caching)
+            cache_ttl: Seconds a cached result stays valid
+            engine: Text extraction engine name ('pypdf2', 'pypdf2-columns' or 'pdftotext')
+            min_text_length: Fewest characters of text for an extraction to count as successful
+            max_failed_page_ratio: Largest fraction of unreadable pages tolerated before the
+                extraction is treated as failed
+            address_cues: Phrases after which a contact address is looked for
+            streaming: Read pages one at a time and stop once every target field has been found
+                (see streaming_targets for the fields this can miss)
+            language: Patterns to use: 'th', 'en', 'both', or 'auto' to choose from the text
+            delivery_cues: Phrases after which the delivery or work location is looked for
+            clock: Time source for cache expiry, the system clock when omitted
+            cache_dir: Folder where extraction results are also kept for later runs
+                (None to cache in memory only)
+        """
+        if language not in LANGUAGES:
+            raise ValueError(f"Unknown extraction language: {language}")
+        self.min_text_length = min_text_length
+        self.max_failed_page_ratio = max_failed_page_ratio
+        self.address_cues = address_cues
+        self.delivery_cues = delivery_cues
+        self.streaming = streaming
+        self.language = language
         self.thai_to_arabic = str.maketrans('๐๑๒๓๔๕๖๗๘๙', '0123456789')
+        self.cache = ExtractionCache(cache_size, cache_ttl, clock, cache_dir)
+        self.engine = get_engine(engine)
+        self.ruleset_hash = self.compute_ruleset_hash()
+
+    def compute_ruleset_hash(self):
+        """Hash the extraction rules and settings so changing either invalidates cached results"""
+        rules = b''.join(rule_module_source(name) for name in RULE_MODULES)
+        settings = repr((self.min_text_length, self.max_failed_page_ratio, tuple(self.address_cues),
+                         self.streaming, self.language, tuple(self.delivery_cues)))
+        return hashlib.sha256(rules + settings.encode('utf-8')).hexdigest()[:16]
+
+    def is_thai_text(self, text):
+        """Check whether a meaningful share of the text's letters are Thai"""
+        thai = sum(1 for c in text if '\u0e01' <= c <= '\u0e4c')
+        latin = sum(1 for c in text if c.isascii() and c.isalpha())
+        return thai > 0 and thai >= 0.2 * (thai + latin)
+
+    def text_languages(self, text):
+        """Languages whose patterns are tried on the text, in order of preference"""
+        if self.language == 'both':
+            return ('th', 'en')
+        if self.language != 'auto':
+            return (self.language,)
+        # Thai documents often carry English terms, so English patterns stay as a fallback
+        return ('th', 'en') if self.is_thai_text(text) else ('en',)
+
+    def search_field(self, field, text):
+        """Search the text for a field with each language's pattern, returning the first match"""
+        for language in self.text_languages(text):
+            match = re.search(PATTERNS[language][field], text)
+            if match:
+                return match
+        return None
 
     def convert_thai_number(self, thai_number):
         """Convert Thai numerals to Arabic numerals"""
@@ -12,11 +154,38 @@ class PDFExtractor:
 
     def extract_budget(self, text):
         """Extract budget amount from text"""
-        # Look for numbers followed by บาท
-        pattern = r'([\d,]+\.?\d*)\s*บาท'
-        match = re.search(pattern, text)
+        # The bid guarantee is also an amount in baht, so it is removed before looking for the budget
+        for language in self.text_languages(text):
+            text = re.sub(PATTERNS[language]['bid_security'], ' ', text)
+
+        # A range ("ตั้งแต่ X ถึง Y บาท") is filtered on by its upper bound
+        range_match = self.search_field('budget_range', text)
+        if range_match:
+            bounds = sorted((range_match.group(1), range_match.group(2)), key=lambda a: float(a.replace(',', '') or 0))
+            return {
+                'amount': bounds[1],
+                'amount_clean': bounds[1].replace(',', ''),
+                'min': bounds[0].replace(',', ''),
+                'max': bounds[1].replace(',', ''),
+            }
+
+        # Look for numbers followed by บาท (or baht/THB in English documents)
+        match = self.search_field('budget', text)
+        if match:
+            amount = match.group(match.lastindex)
+            return {
+                'amount': amount,
+                'amount_clean': amount.replace(',', ''),
+                'min': None,
+                'max': None,
+            }
+        return None
+
+    def extract_bid_security(self, text):
+        """Extract the bid guarantee (หลักประกันการเสนอราคา) amount bidders must post"""
+        match = self.search_field('bid_security', text)
         if match:
-            amount = match.group(1)
+            amount = match.group(match.lastindex)
             return {
                 'amount': amount,
                 'amount_clean': amount.replace(',', '')
@@ -31,14 +200,41 @@ class PDFExtractor:
             return matches[0]  # Return first match
         return None
 
+    def extract_spec_items(self, text):
+        """Extract specification line items (description, quantity, unit)"""
+        # Line layout: "1. เครื่องคอมพิวเตอร์ จำนวน 10 เครื่อง" or "(1) ... จำนวน 2 ชุด"
+        pattern = r'^\s*(?:\(?\d+\s*[.)]\s*)?(?P<description>.+?)\s*จำนวน\s*(?P<quantity>[\d,]+)\s*(?P<unit>[^\s\d(),]+)?'
+
+        items = []
+        for line in text.splitlines():
+            match = re.search(pattern, line)
+            if not match:
+                continue
+            # The capture may be only separators ("จำนวน , ชุด"), which is not a quantity
+            quantity = self.convert_thai_number(match.group('quantity')).replace(',', '')
+            try:
+                quantity = int(quantity)
+            except ValueError:
+                continue
+            items.append({
+                'description': ' '.join(match.group('description').split()),
+                'quantity': quantity,
+                'unit': match.group('unit'),
+            })
+        return items if items else None
+
+    def flatten_spec_items(self, items):
+        """Join specification line items into one line of text ("เครื่องคอมพิวเตอร์ 10 เครื่อง; ...")"""
+        if not items:
+            return None
+        return '; '.join(' '.join(str(part) for part in (item['description'], item['quantity'], item['unit']) if part)
+                         for item in items)
+
     def extract_duration(self, text):
         """Extract contract duration"""
-        year_pattern = r'ระยะเวลา\s*(\d+)\s*ปี'
-        month_pattern = r'\((\d+)\s*เดือน\)'
-        
         duration = {}
-        year_match = re.search(year_pattern, text)
-        month_match = re.search(month_pattern, text)
+        year_match = self.search_field('years', text)
+        month_match = self.search_field('months', text)
         
         if year_match:
             duration['years'] = year_match.group(1)
@@ -47,71 +243,293 @@ class PDFExtractor:
         return duration if duration else None
 
     def extract_submission_info(self, text):
-        """Extract submission date and time"""
-        # Looking for dates with Thai month names
-        date_pattern = r'วันที่\s*(\d+.*\d{4})'
-        time_pattern = r'(\d{2}[:\.]\d{2})\s*น'
-        
+        """Extract submission date and time, and the labeled dates of each submission window"""
+        # Looking for dates with Thai (or English) month names
         submission_info = {}
-        date_match = re.search(date_pattern, text)
-        time_match = re.search(time_pattern, text)
+        date_match = self.search_field('date', text)
+        time_match = self.search_field('time', text)
         
         if date_match:
             submission_info['date'] = date_match.group(1).strip()
         if time_match:
             submission_info['time'] = time_match.group(1)
-        return submission_info if submission_info else None
+
+        windows = self.extract_submission_windows(text)
+        if not submission_info and not any(windows.values()):
+            return None
+        submission_info.update(windows)
+        return submission_info
+
+    def extract_submission_windows(self, text):
+        """Extract the document sale period, clarification date and bid submission deadline"""
+        # A single Thai date: "15 มกราคม 2567" or "15 ม.ค. 2567", in Thai or Arabic digits
+        date = r'[\d๐-๙]{1,2}\s*[\u0e01-\u0e4c.]+\s*[\d๐-๙]{4}'
+        sale_cue = r'(?:จำหน่าย|ขาย|ดาวน์โหลด)เอกสาร'
+        sale_pattern = (sale_cue + r'.{0,200}?วันที่\s*(' + date +
+                        r').{0,50}?ถึง(?:วันที่)?\s*(' + date + r')')
+        clarification_pattern = r'ชี้แจง.{0,100}?วันที่\s*(' + date + r')'
+        deadline_pattern = r'ยื่น(?:ข้อเสนอ|ซอง).{0,200}?วันที่\s*(' + date + r')'
+
+        # Line breaks from the PDF reader fall inside these phrases
+        flattened = ' '.join(text.split())
+        windows = {
+            'document_sale_start': '',
+            'document_sale_end': '',
+            'document_sale_start_date': None,
+            'document_sale_end_date': None,
+            'clarification_date': '',
+            'submission_deadline': '',
+            'submission_deadline_date': None,
+        }
+
+        sale_match = re.search(sale_pattern, flattened)
+        if sale_match:
+            windows['document_sale_start'] = sale_match.group(1)
+            windows['document_sale_end'] = sale_match.group(2)
+        # The parsed period also covers ranges whose start shares the end's month ("1 - 15 ม.ค. 2567")
+        sale_cue_match = re.search(sale_cue, flattened)
+        if sale_cue_match:
+            sale_range = parse_thai_date_range(flattened[sale_cue_match.end():sale_cue_match.end() + 250])
+        else:
+            sale_range = None
+        if sale_range:
+            windows['document_sale_start_date'] = sale_range[0].isoformat()
+            windows['document_sale_end_date'] = sale_range[1].isoformat()
+        clarification_match = re.search(clarification_pattern, flattened)
+        if clarification_match:
+            windows['clarification_date'] = clarification_match.group(1)
+        deadline_match = re.search(deadline_pattern, flattened)
+        if deadline_match:
+            windows['submission_deadline'] = deadline_match.group(1)
+            deadline = parse_thai_date(deadline_match.group(1))
+            windows['submission_deadline_date'] = deadline.isoformat() if deadline else None
+        return windows
 
     def extract_contact_info(self, text):
         """Extract contact information"""
-        phone_pattern = r'โทรศัพท์.*?(\d[\d\-]+)'
         email_pattern = r'([a-zA-Z0-9_.+-]+@[a-zA-Z0-9-]+\.[a-zA-Z0-9-.]+)'
         
         contact_info = {}
-        phone_match = re.search(phone_pattern, text)
+        phone_match = self.search_field('phone', text)
         email_match = re.search(email_pattern, text)
         
         if phone_match:
             contact_info['phone'] = phone_match.group(1)
         if email_match:
             contact_info['email'] = email_match.group(1)
+
+        address = self.extract_address(text)
+        if address:
+            contact_info['address'] = address
         return contact_info if contact_info else None
 
+    def extract_address(self, text):
+        """Extract a Thai postal address (subdistrict, district, province, postal code) near a contact cue"""
+        # House number, then subdistrict and district, ending at the 5-digit postal code
+        address_pattern = (r'((?:เลขที่\s*)?[\d๐-๙]+(?:/[\d๐-๙]+)?\s.{0,120}?'
+                           r'(?:ตำบล|ต\.|แขวง)\s*\S+.{0,60}?'
+                           r'(?:อำเภอ|อ\.|เขต)\s*\S+.{0,80}?'
+                           r'(?<![\d๐-๙])[\d๐-๙]{5}(?![\d๐-๙]))')
+
+        # Addresses are often split across lines by the PDF reader
+        flattened = ' '.join(text.split())
+        for cue in self.address_cues:
+            for cue_match in re.finditer(re.escape(cue), flattened):
+                window = flattened[cue_match.end():cue_match.end() + 300]
+                address_match = re.search(address_pattern, window)
+                if address_match:
+                    return address_match.group(1)
+        return None
+
+    def extract_delivery_location(self, text):
+        """Extract where goods are delivered or the work is done, with the province it is in"""
+        lines = text.splitlines()
+        for i, line in enumerate(lines):
+            for cue in self.delivery_cues:
+                position = line.find(cue)
+                if position < 0:
+                    continue
+                # The location follows the cue on its line, or is on the next line when the cue is a heading
+                location = line[position + len(cue):]
+                if not location.strip(' :：-'):
+                    location = next((l for l in lines[i + 1:i + 3] if l.strip()), '')
+                location = ' '.join(location.split()).lstrip(' :：-')
+                location = re.sub(r'^(?:(?:พัสดุ|งาน)\s*)?(?:คือ|ได้แก่|ณ)\s*', '', location)
+                for end in DELIVERY_LOCATION_ENDS:
+                    if end in location:
+                        location = location[:location.find(end)]
+                location = location[:200].strip(' .,')
+                if location:
+                    return {'location': location, 'province': classify_province(location)}
+        return None
+
+    def extract_reference_urls(self, text):
+        """Extract distinct, well-formed web links (e.g. the e-bidding portal page) in document order"""
+        # Thai text often runs straight into a link with no space, so Thai characters end a URL
+        url_pattern = r'(?:https?://|www\.)[^\s<>"\'()\u0e00-\u0e7f]+'
+
+        urls = []
+        for match in re.finditer(url_pattern, text, re.IGNORECASE):
+            url = match.group(0).rstrip('.,;:!?')
+            if url.lower().startswith('www.'):
+                url = 'http://' + url
+            parsed = urlparse(url)
+            if parsed.scheme.lower() not in ('http', 'https') or '.' not in parsed.netloc:
+                continue
+            if url not in urls:
+                urls.append(url)
+        return urls if urls else None
+
+    def extract_authority(self, text):
+        """Extract the procurement committee members and the signing (approving) officer"""
+        titles = '|'.join(re.escape(title) for title in NAME_TITLES)
+        name = rf'(?:{titles})\s*[^\s\d()]+\s+[^\s\d()]+'
+        roles = '|'.join(COMMITTEE_ROLES)
+        member_pattern = rf'^\s*(?:\(?\d+\s*[.)]\s*)?(?P<name>{name})\s*(?P<role>{roles})?'
+
+        # Members are listed one per line under the "คณะกรรมการ..." heading
+        committee = []
+        lines = text.splitlines()
+        for i, line in enumerate(lines):
+            if 'คณะกรรมการ' not in line:
+                continue
+            for member_line in lines[i + 1:i + 16]:
+                match = re.search(member_pattern, member_line)
+                if not match:
+                    if committee:
+                        break
+                    continue
+                member = {'name': ' '.join(match.group('name').split()), 'role': match.group('role')}
+                if member not in committee:
+                    committee.append(member)
+            if committee:
+                break
+
+        # The signatory block near the end reads "(นาย ...)" with the officer's position on the next line
+        signatory = None
+        for match in re.finditer(rf'\(\s*(?P<name>{name})\s*\)[ \t]*\n?[ \t]*(?P<position>[^\n]*)', text):
+            position = match.group('position').strip()
+            signatory = {'name': ' '.join(match.group('name').split()), 'position': position or None}
+
+        if not committee and not signatory:
+            return None
+        return {'committee': committee or None, 'signatory': signatory}
+
+    def extract_notice_type(self, text):
+        """Detect an amendment or cancellation document from its heading"""
+        # Only the heading is checked; tender terms routinely mention cancelling or amending
+        return classify_notice(' '.join(text.split())[:300])
+
+    def extract_province(self, contact_info, text):
+        """Classify the project's province, preferring the contact address over the full text"""
+        address = (contact_info or {}).get('address')
+        return classify_province(address) or classify_province(text)
+
+    def streaming_targets(self):
+        """
+        Fields that must all be found before streaming extraction stops reading pages
+        The signatory and delivery location are usually near the end of the notice, so they are
+        targets too; a document without them is read to the end. Fields outside this list (bid
+        security, spec items, reference URLs, committee members) only cover the pages read.
+        """
+        return {
+            'budget': self.extract_budget,
+            'duration': self.extract_duration,
+            'submission_info': self.extract_submission_info,
+            'contact_info': self.extract_contact_info,
+            'signatory': lambda text: (self.extract_authority(text) or {}).get('signatory'),
+            'delivery_location': self.extract_delivery_location,
+        }
+
     def parse_pdf(self, pdf_path):
-        """Parse PDF and extract key information"""
+        """
+        Parse PDF and extract key information
+        Returns None when the document has no usable text; raises PDFParseError when it cannot be read
+        """
         try:
             with open(pdf_path, 'rb') as file:
-                reader = PyPDF2.PdfReader(file)
-                full_text = ''
-                
-                # Print each page text for debugging
-                print("\nExtracting text from PDF pages:")
-                for i, page in enumerate(reader.pages):
-                    page_text = page.extract_text()
-                    print(f"\nPage {i+1}:")
-                    print("-" * 30)
-                    print(page_text[:200] + "...")  # Print first 200 chars of each page
-                    full_text += page_text + '\n'
-
-                # Extract all information
-                info = {
-                    'budget': self.extract_budget(full_text),
-                    'specifications': self.extract_quantity_specs(full_text),
-                    'duration': self.extract_duration(full_text),
-                    'submission_info': self.extract_submission_info(full_text),
-                    'contact_info': self.extract_contact_info(full_text),
-                }
-                
-                return info
+                data = file.read()
+
+            # Identical documents share one extraction result per engine and ruleset
+            content_hash = f"{self.engine.name}:{self.ruleset_hash}:{hashlib.sha256(data).hexdigest()}"
+            cached = self.cache.get(content_hash)
+            if cached is not None:
+                logging.debug(f"Using cached extraction for {pdf_path}")
+                return cached
+
+            page_count, pages = self.engine.open_pages(data)
+            full_text = ''
+            previous_tail = ''
+            pages_read = 0
+            failed_pages = 0
+            targets = self.streaming_targets() if self.streaming else {}
+
+            logging.debug(f"Extracting text from {page_count} pages of {pdf_path} ({self.engine.name})")
+            for i, page_text in enumerate(pages):
+                pages_read += 1
+                if page_text is None:
+                    logging.warning(f"Page {i+1} of {pdf_path} could not be read, skipping")
+                    failed_pages += 1
+                    previous_tail = ''
+                    continue
+                logging.debug(f"Page {i+1} of {pdf_path}: {page_text[:200]}...")
+                full_text += page_text + '\n'
+
+                # Only look for fields not yet found, and only in the new page's text
+                window = previous_tail + page_text
+                targets = {name: extract for name, extract in targets.items() if not extract(window)}
+                previous_tail = page_text[-STREAMING_OVERLAP:]
+                if self.streaming and not targets and pages_read < page_count:
+                    logging.debug(f"All target fields found after {pages_read} of {page_count} pages, stopping early")
+                    break
+
+            if failed_pages:
+                logging.warning(f"{failed_pages} of {pages_read} pages could not be read from {pdf_path}")
+                if failed_pages / pages_read > self.max_failed_page_ratio:
+                    logging.error(f"Too many unreadable pages in {pdf_path}, treating extraction as failed")
+                    return None
+
+            # Scanned or broken PDFs yield little or no text
+            text_length = len(full_text.strip())
+            if text_length < self.min_text_length:
+                logging.warning(f"Insufficient text extracted from {pdf_path}: "
+                                f"{text_length} characters (minimum {self.min_text_length})")
+                return None
+
+            # Extract all information
+            info = {
+                'page_count': page_count,
+                'failed_pages': failed_pages,
+                'budget': self.extract_budget(full_text),
+                'bid_security': self.extract_bid_security(full_text),
+                'specifications': self.extract_quantity_specs(full_text),
+                'spec_items': self.extract_spec_items(full_text),
+                'duration': self.extract_duration(full_text),
+                'submission_info': self.extract_submission_info(full_text),
+                'contact_info': self.extract_contact_info(full_text),
+                'reference_urls': self.extract_reference_urls(full_text),
+                'authority': self.extract_authority(full_text),
+                'notice_type': self.extract_notice_type(full_text),
+                'delivery_location': self.extract_delivery_location(full_text),
+                'raw_text': full_text,
+            }
+            info['province'] = self.extract_province(info['contact_info'], full_text)
+            info['spec_text'] = self.flatten_spec_items(info['spec_items'])
+
+            self.cache.put(content_hash, info)
+            return info
         except Exception as e:
-            print(f"Error parsing PDF: {e}")
-            return None
+            logging.exception(f"Error parsing PDF {pdf_path}")
+            raise PDFParseError(pdf_path, e) from e
 
 def main():
     extractor = PDFExtractor()
     
     pdf_path = "sample.pdf"
-    results = extractor.parse_pdf(pdf_path)
+    try:
+        results = extractor.parse_pdf(pdf_path)
+    except PDFParseError:
+        return
     
     if results:
         print("\nExtracted Information:")
@@ -124,11 +542,17 @@ def main():
             clean_amount = arabic_amount.replace(',', '')
             print(f"\nBudget:")
             print(f"Amount: {arabic_amount} บาท")
-            print(f"Clean amount: {float(clean_amount):,.2f} บาท")
+            print(f"Clean amount: {format_thb(float(clean_amount))}")
         
         if results['specifications']:
             quantity = results['specifications'].translate(extractor.thai_to_arabic)
             print(f"\nQuantity: {quantity}")
+
+        if results['spec_items']:
+            print(f"\nSpecification Items:")
+            for item in results['spec_items']:
+                unit = item['unit'] or ''
+                print(f"- {item['description']}: {item['quantity']} {unit}".rstrip())
         
         if results['duration']:
             print(f"\nDuration:")
@@ -155,6 +579,15 @@ def main():
             if 'time' in results['submission_info']:
                 time = results['submission_info']['time'].translate(extractor.thai_to_arabic)
                 print(f"- Time: {time}")
+            labels = [
+                ('document_sale_start', 'Document sale start'),
+                ('document_sale_end', 'Document sale end'),
+                ('clarification_date', 'Clarification'),
+                ('submission_deadline', 'Submission deadline'),
+            ]
+            for key, label in labels:
+                if results['submission_info'].get(key):
+                    print(f"- {label}: {results['submission_info'][key].translate(extractor.thai_to_arabic)}")
         
         if results['contact_info']:
             print(f"\nContact Information:")
@@ -164,6 +597,19 @@ def main():
             if 'email' in results['contact_info']:
                 email = results['contact_info']['email']
                 print(f"- Email: {email}")
+            if 'address' in results['contact_info']:
+                print(f"- Address: {results['contact_info']['address']}")
+
+        if results['reference_urls']:
+            print(f"\nReference URLs:")
+            for url in results['reference_urls']:
+                print(f"- {url}")
+
+        if results['province']:
+            print(f"\nProvince: {results['province']['name']} ({results['province']['region']})")
+
+        if results['delivery_location']:
+            print(f"\nDelivery location: {results['delivery_location']['location']}")
 
 if __name__ == "__main__":
     main()
\ No newline at end of file
@@ -1,24 +1,80 @@
 import logging
 import asyncio
-from datetime import datetime
+import json
+import os
+import random
+from concurrent.futures import ThreadPoolExecutor
+from datetime import datetime, timezone
 from pathlib import Path
 from typing import List, Dict, Optional
 from database.database import Database
-from utils.pdf_download import download_pdfs
-from utils.pdf_extractor import PDFExtractor
+from utils.pdf_download import PDFDownloader
+from utils.pdf_extractor import PDFExtractor, PDFParseError, DEFAULT_CACHE_DIR
+from utils.clock import Clock, SystemClock
+from utils.content_schema import wrap_content
+from utils.duration_stats import DurationStats
+from utils.memory_guard import InFlightGuard
+from utils.timestamps import to_storage, BANGKOK
 
 class PDFProcessor:
-    def __init__(self, db: Database):
+    def __init__(self, db: Database, entry_timeout: Optional[float] = None,
+                 max_download_bytes: Optional[int] = None, force: bool = False,
+                 extractor: Optional[PDFExtractor] = None, output_dir: Optional[str] = None,
+                 clock: Optional[Clock] = None, min_pages: int = 0,
+                 allowed_hosts: Optional[List[str]] = None, denied_hosts: Optional[List[str]] = None,
+                 store_raw_text: bool = False, max_run_duration: Optional[float] = None,
+                 max_in_flight_bytes: Optional[int] = None):
+        """
+        Args:
+            db: Open database connection
+            entry_timeout: Seconds allowed for download, extraction and storage
+                of a single announcement (None for no limit)
+            max_download_bytes: Bytes that may be downloaded per batch (None for no limit)
+            force: Reprocess announcements that already have extracted details
+            extractor: Configured PDF extractor, a default extractor when omitted
+            output_dir: Directory where each processed announcement is also written
+                as <announcement_id>.json (None to only store in the database)
+            clock: Time source shared with the downloader, the system clock when omitted
+            min_pages: Fewest PDF pages for an announcement's details to be stored;
+                shorter documents are marked filtered (0 disables the filter)
+            allowed_hosts: Hosts PDFs may be downloaded from (None for any public host)
+            denied_hosts: Hosts PDFs are never downloaded from
+            store_raw_text: Also store the full extracted text of each PDF, which allows
+                re-parsing without the PDF but considerably grows the database
+            max_run_duration: Seconds after which a batch stops starting new announcements;
+                the one in progress finishes and the rest are deferred (None for no limit)
+            max_in_flight_bytes: Combined size of PDFs being extracted at once, counting timed-out
+                extractions still running in their abandoned threads; further PDFs wait for room
+        """
         self.db = db
-        self.extractor = PDFExtractor()
+        self.force = force
+        self.extractor = extractor or PDFExtractor()
+        self.clock = clock or SystemClock()
+        self.downloader = PDFDownloader(max_total_bytes=max_download_bytes, clock=self.clock,
+                                        allowed_hosts=allowed_hosts, denied_hosts=denied_hosts)
+        self.entry_timeout = entry_timeout
+        self.output_dir = Path(output_dir) if output_dir else None
+        self.min_pages = min_pages
+        self.store_raw_text = store_raw_text
+        self.max_run_duration = max_run_duration
+        self.stats = {}
+        self.durations = DurationStats()
+        # Public so callers can report the in-flight estimate (memory_guard.snapshot())
+        self.memory_guard = InFlightGuard(max_in_flight_bytes)
+        self.executor = None
         
     def process_pdf_data(self, pdf_path: str, announcement_id: int) -> bool:
         """Process a single PDF and store its data"""
+        logging.info(f"Extracting data from {pdf_path}")
         try:
-            # Extract data from PDF
-            logging.info(f"Extracting data from {pdf_path}")
             extracted_data = self.extractor.parse_pdf(pdf_path)
-            
+        except PDFParseError:
+            return False
+        return self.store_extracted_data(extracted_data, pdf_path, announcement_id)
+
+    def store_extracted_data(self, extracted_data: Optional[Dict], pdf_path: str, announcement_id: int) -> bool:
+        """Convert extracted PDF data into procurement details and store them"""
+        try:
             if not extracted_data:
                 logging.error(f"No data extracted from {pdf_path}")
                 return False
@@ -27,14 +83,38 @@ class PDFProcessor:
             procurement_data = {
                 'announcement_id': announcement_id,
                 'budget_amount': None,
+                'budget_min': None,
+                'budget_max': None,
+                'bid_security': None,
                 'quantity': None,
+                'spec_items': None,
+                'spec_text': None,
                 'duration_years': None,
                 'duration_months': None,
                 'submission_date': None,
                 'submission_time': None,
+                'document_sale_start': None,
+                'document_sale_end': None,
+                'document_sale_start_date': None,
+                'document_sale_end_date': None,
+                'clarification_date': None,
+                'submission_deadline': None,
+                'submission_deadline_date': None,
                 'contact_phone': None,
                 'contact_email': None,
-                'extracted_at': datetime.now()
+                'contact_address': None,
+                'province': None,
+                'region': None,
+                'delivery_location': None,
+                'delivery_province': None,
+                'reference_urls': None,
+                'committee': None,
+                'signatory_name': None,
+                'signatory_position': None,
+                'raw_text': extracted_data.get('raw_text') if self.store_raw_text else None,
+                'page_count': extracted_data.get('page_count'),
+                'failed_pages': extracted_data.get('failed_pages'),
+                'extracted_at': to_storage(self.clock.now(timezone.utc))
             }
             
             # Budget
@@ -42,15 +122,31 @@ class PDFProcessor:
                 try:
                     clean_amount = extracted_data['budget']['amount_clean']
                     procurement_data['budget_amount'] = float(clean_amount)
+                    if extracted_data['budget'].get('min') is not None:
+                        procurement_data['budget_min'] = float(extracted_data['budget']['min'])
+                        procurement_data['budget_max'] = float(extracted_data['budget']['max'])
                 except (ValueError, KeyError) as e:
                     logging.warning(f"Could not parse budget amount: {e}")
             
+            # Bid guarantee
+            if extracted_data.get('bid_security'):
+                try:
+                    procurement_data['bid_security'] = float(extracted_data['bid_security']['amount_clean'])
+                except (ValueError, KeyError) as e:
+                    logging.warning(f"Could not parse bid security amount: {e}")
+            
             # Quantity
             if extracted_data.get('specifications'):
                 try:
                     procurement_data['quantity'] = int(extracted_data['specifications'])
                 except ValueError as e:
                     logging.warning(f"Could not parse quantity: {e}")
+
+            # Specification line items
+            if extracted_data.get('spec_items'):
+                procurement_data['spec_items'] = json.dumps(extracted_data['spec_items'], ensure_ascii=False,
+                                                           sort_keys=True)
+                procurement_data['spec_text'] = extracted_data.get('spec_text')
             
             # Duration
             if extracted_data.get('duration'):
@@ -73,12 +169,42 @@ class PDFProcessor:
                     procurement_data['submission_date'] = submission['date']
                 if 'time' in submission:
                     procurement_data['submission_time'] = submission['time']
+                for key in ('document_sale_start', 'document_sale_end', 'document_sale_start_date',
+                            'document_sale_end_date', 'clarification_date', 'submission_deadline',
+                            'submission_deadline_date'):
+                    procurement_data[key] = submission.get(key) or None
             
             # Contact info
             if extracted_data.get('contact_info'):
                 contact = extracted_data['contact_info']
                 procurement_data['contact_phone'] = contact.get('phone')
                 procurement_data['contact_email'] = contact.get('email')
+                procurement_data['contact_address'] = contact.get('address')
+            
+            # Reference links
+            if extracted_data.get('reference_urls'):
+                procurement_data['reference_urls'] = json.dumps(extracted_data['reference_urls'], ensure_ascii=False)
+            
+            # Committee and approving officer
+            if extracted_data.get('authority'):
+                authority = extracted_data['authority']
+                if authority.get('committee'):
+                    procurement_data['committee'] = json.dumps(authority['committee'], ensure_ascii=False,
+                                                               sort_keys=True)
+                if authority.get('signatory'):
+                    procurement_data['signatory_name'] = authority['signatory']['name']
+                    procurement_data['signatory_position'] = authority['signatory']['position']
+            
+            # Province
+            if extracted_data.get('province'):
+                procurement_data['province'] = extracted_data['province']['name']
+                procurement_data['region'] = extracted_data['province']['region']
+
+            # Delivery location
+            if extracted_data.get('delivery_location'):
+                delivery = extracted_data['delivery_location']
+                procurement_data['delivery_location'] = delivery['location']
+                procurement_data['delivery_province'] = (delivery['province'] or {}).get('name')
             
             # Insert into database
             self.insert_procurement_details(procurement_data)
@@ -88,10 +214,220 @@ class PDFProcessor:
         except Exception as e:
             logging.error(f"Error processing PDF {pdf_path}: {e}")
             return False
+
+    async def process_batch(self, announcements: List[Dict]) -> List[bool]:
+        """Process announcements one at a time, each within the entry deadline"""
+        # Extraction runs in a worker thread so the event loop can give up on a stuck PDF
+        self.executor = ThreadPoolExecutor(max_workers=1)
+        self.downloader.reset_download_budget()
+        self.downloader.sweep_orphans()
+        self.stats = {'fetched': len(announcements), 'processed': 0, 'skipped': 0,
+                      'deferred': 0, 'filtered': 0, 'failed': 0, 'bytes_downloaded': 0}
+        results = []
+        started = self.clock.monotonic()
+        time_bounded = 0
+        try:
+            async with self.downloader:
+                for position, announcement in enumerate(announcements):
+                    elapsed = self.clock.monotonic() - started
+                    if self.max_run_duration is not None and elapsed >= self.max_run_duration:
+                        # Announcements not started are not in results, so they are counted apart
+                        time_bounded = len(announcements) - position
+                        logging.warning(f"Run time-bounded after {elapsed:.0f}s (limit {self.max_run_duration:.0f}s), "
+                                        f"deferring {time_bounded} announcements to the next run")
+                        self.stats['deferred'] += time_bounded
+                        break
+                    if not self.force and (self.db.has_procurement_details(announcement['id']) or
+                                           self.db.get_download_status(announcement['id']) == 'filtered' or
+                                           self.db.is_dead_lettered(announcement['id'])):
+                        self.stats['skipped'] += 1
+                        continue
+                    results.append(await self.process_entry(announcement))
+
+            if self.stats['skipped']:
+                logging.info(f"Skipped {self.stats['skipped']} announcements already extracted, filtered or dead-lettered")
+            self.close_past_deadlines()
+            return results
+        finally:
+            self.stats['processed'] = sum(1 for success in results if success)
+            self.stats['failed'] = (len(results) - self.stats['processed'] -
+                                    self.stats['deferred'] - self.stats['filtered'] + time_bounded)
+            self.stats['bytes_downloaded'] = self.downloader.bytes_downloaded
+            self.downloader.log_latency()
+            self.log_durations()
+            if self.memory_guard.waits:
+                logging.info(f"{self.memory_guard.waits} extractions waited for in-flight PDFs to finish")
+            self.executor.shutdown(wait=False, cancel_futures=True)
+
+    async def process_entry(self, announcement: Dict) -> bool:
+        """Download, extract and store a single announcement"""
+        project_id = announcement.get('project_id') or 'unknown'
+        try:
+            return await asyncio.wait_for(
+                self._process_entry(announcement, project_id),
+                timeout=self.entry_timeout
+            )
+        except asyncio.TimeoutError:
+            error = f"Processing timed out after {self.entry_timeout}s"
+            logging.error(f"{error} for project {project_id}")
+            self.db.add_dead_letter(announcement['id'], error, 1)
+            # A thread cannot be stopped, so a stuck extraction keeps its worker;
+            # later entries get a new one instead of queueing behind it
+            self.executor.shutdown(wait=False, cancel_futures=True)
+            self.executor = ThreadPoolExecutor(max_workers=1)
+            return False
+
+    async def _process_entry(self, announcement: Dict, project_id: str) -> bool:
+        url = announcement.get('link')
+        if not url:
+            logging.warning(f"No URL found for project {project_id}")
+            return False
+
+        started = self.clock.monotonic()
+        filepath = await self.downloader.download_pdf(url, project_id)
+        self.durations.record('download', self.clock.monotonic() - started)
+        if not filepath and self.downloader.budget_exhausted():
+            logging.warning(f"Deferring project {project_id} until the next run")
+            self.stats['deferred'] += 1
+            return False
+        if not filepath:
+            exhausted = self.downloader.exhausted_downloads.pop(url, None)
+            if exhausted:
+                logging.error(f"Moving project {project_id} to the dead letter table: {exhausted['error']}")
+                self.db.add_dead_letter(announcement['id'], exhausted['error'], exhausted['attempts'])
+            logging.warning(f"Skipping extraction for failed download: {project_id}")
+            return False
+        self.db.insert_download(announcement['id'], filepath, 'completed')
+
+        logging.info(f"Extracting data from {filepath}")
+        loop = asyncio.get_running_loop()
+        started = self.clock.monotonic()
+        try:
+            extracted_data = await loop.run_in_executor(self.executor, self.extract_in_flight, filepath)
+        except PDFParseError as e:
+            # Reading the same file again would fail the same way, unlike a document without text
+            logging.error(f"Moving project {project_id} to the dead letter table: {e}")
+            self.db.add_dead_letter(announcement['id'], str(e), 1)
+            return False
+        finally:
+            self.durations.record('extract', self.clock.monotonic() - started)
+
+        # Database writes stay on the event loop thread that owns the connection
+        return self.finish_entry(announcement, extracted_data, filepath)
+
+    def extract_in_flight(self, filepath: str) -> Optional[Dict]:
+        """Extract a PDF once its size fits under the in-flight ceiling, counting it until done"""
+        # A timed-out extraction keeps its bytes until its thread finishes, so later PDFs wait for it
+        with self.memory_guard.hold(os.path.getsize(filepath)):
+            return self.extractor.parse_pdf(filepath)
+
+    def finish_entry(self, announcement: Dict, extracted_data: Optional[Dict], filepath: str) -> bool:
+        """Store an announcement's extracted data unless its document is too short to be useful"""
+        if extracted_data and self.min_pages and extracted_data.get('page_count', 0) < self.min_pages:
+            logging.info(f"Filtering {filepath}: {extracted_data.get('page_count', 0)} pages "
+                         f"(minimum {self.min_pages})")
+            self.db.insert_download(announcement['id'], filepath, 'filtered')
+            self.stats['filtered'] += 1
+            return False
+
+        # The feed title does not always say so, but the document heading does
+        if extracted_data and extracted_data.get('notice_type') and not announcement.get('notice_type'):
+            original_id = self.db.mark_notice(announcement['id'], extracted_data['notice_type'])
+            logging.info(f"Announcement {announcement['id']} is a {extracted_data['notice_type']} notice"
+                         + (f" of announcement {original_id}" if original_id else ""))
+
+        started = self.clock.monotonic()
+        stored = self.store_extracted_data(extracted_data, filepath, announcement['id'])
+        self.durations.record('store', self.clock.monotonic() - started)
+        if stored:
+            self.write_json_dump(announcement, extracted_data)
+        return stored
+    
+    def reextract_batch(self, announcements: List[Dict]) -> List[bool]:
+        """Re-run extraction on already downloaded PDFs and replace the stored details"""
+        self.stats = {'fetched': len(announcements), 'processed': 0, 'skipped': 0,
+                      'deferred': 0, 'filtered': 0, 'failed': 0, 'bytes_downloaded': 0}
+        results = []
+        for announcement in announcements:
+            project_id = announcement.get('project_id') or 'unknown'
+            url = announcement.get('link')
+            filepath = self.downloader.get_filepath(url, project_id) if url else None
+            if not filepath or not filepath.exists():
+                logging.info(f"No cached PDF for project {project_id}, skipping")
+                self.stats['skipped'] += 1
+                continue
+
+            logging.info(f"Re-extracting data from {filepath}")
+            started = self.clock.monotonic()
+            try:
+                extracted_data = self.extractor.parse_pdf(str(filepath))
+            except PDFParseError:
+                # The details stored from an earlier extraction are kept
+                results.append(False)
+                continue
+            finally:
+                self.durations.record('extract', self.clock.monotonic() - started)
+            # Storing updates the existing details in place, so they survive a failed extraction or store
+            results.append(self.finish_entry(announcement, extracted_data, str(filepath)))
+        self.close_past_deadlines()
+
+        self.stats['processed'] = sum(1 for success in results if success)
+        self.stats['failed'] = len(results) - self.stats['processed'] - self.stats['filtered']
+        self.log_durations()
+        return results
+
+    def close_past_deadlines(self) -> int:
+        """Close tenders whose submission deadline has passed, by the processor's clock"""
+        return self.db.close_past_deadlines(self.clock.now(BANGKOK).date())
+
+    def log_durations(self):
+        """Log the per-entry duration percentiles of each processing stage"""
+        for stage, summary in self.durations.summary().items():
+            logging.info(f"{stage.capitalize()} time over {summary['count']} entries: "
+                         f"p50 {summary['p50']:.2f}s, p90 {summary['p90']:.2f}s, "
+                         f"p99 {summary['p99']:.2f}s, max {summary['max']:.2f}s")
+    
+    def write_json_dump(self, announcement: Dict, extracted_data: Dict) -> Optional[Path]:
+        """Write an announcement and its extracted data to <announcement_id>.json in the output directory"""
+        if not self.output_dir:
+            return None
+        try:
+            self.output_dir.mkdir(parents=True, exist_ok=True)
+            filepath = self.output_dir / f"{announcement['id']}.json"
+            feed_fields = ('id', 'title', 'link', 'published_date', 'description',
+                           'project_id', 'dept_id', 'announce_type')
+            dump = wrap_content({
+                'announcement': {key: announcement.get(key) for key in feed_fields},
+                'extracted': {key: value for key, value in extracted_data.items()
+                              if key != 'raw_text' or self.store_raw_text},
+            })
+
+            # Write to a temporary file first so readers never see a partial dump
+            # Keys are sorted so identical extractions produce byte-identical files
+            temp_path = filepath.with_name(filepath.name + '.tmp')
+            with open(temp_path, 'w', encoding='utf-8') as f:
+                json.dump(dump, f, ensure_ascii=False, indent=2, sort_keys=True, default=str)
+            os.replace(temp_path, filepath)
+            logging.info(f"Wrote JSON dump: {filepath}")
+            return filepath
+        except Exception as e:
+            logging.error(f"Error writing JSON dump for announcement {announcement.get('id')}: {e}")
+            return None
     
     def insert_procurement_details(self, data: Dict) -> Optional[int]:
-        """Insert procurement details into database"""
+        """Insert procurement details into database, updating the existing row when reprocessing"""
         try:
+            self.db.cursor.execute(
+                "SELECT id FROM procurement_details WHERE announcement_id = ? ORDER BY id DESC LIMIT 1",
+                (data['announcement_id'],)
+            )
+            existing = self.db.cursor.fetchone()
+            if existing:
+                assignments = ', '.join(f"{column} = ?" for column in data.keys())
+                query = f"UPDATE procurement_details SET {assignments} WHERE id = ?"
+                self.db.execute_write(query, tuple(data.values()) + (existing['id'],))
+                return existing['id']
+
             placeholders = ', '.join('?' * len(data))
             columns = ', '.join(data.keys())
             values = tuple(data.values())
@@ -102,55 +438,137 @@ class PDFProcessor:
                 VALUES ({placeholders})
             """
             
-            self.db.cursor.execute(query, values)
-            self.db.conn.commit()
+            self.db.execute_write(query, values)
             return self.db.cursor.lastrowid
             
         except Exception as e:
             logging.error(f"Error inserting procurement details: {e}")
             return None
 
-def process_announcements(db: Database, dept_id: Optional[str] = None, limit: int = 10):
+def sample_announcements(announcements: List[Dict], fraction: Optional[float],
+                         seed: Optional[int] = None) -> List[Dict]:
+    """Randomly keep a fraction of the announcements, in their original order; the same seed keeps the same ones"""
+    if fraction is None or fraction >= 1:
+        return announcements
+    count = round(len(announcements) * fraction)
+    chosen = set(random.Random(seed).sample(range(len(announcements)), count))
+    sampled = [announcement for i, announcement in enumerate(announcements) if i in chosen]
+    logging.info(f"Sampled {len(sampled)} of {len(announcements)} announcements (fraction {fraction}, seed {seed})")
+    return sampled
+
+def process_announcements(db: Database, dept_id: Optional[str] = None, limit: int = 10,
+                          entry_timeout: Optional[float] = 300,
+                          max_download_bytes: Optional[int] = None,
+                          engine: str = 'pypdf2', force: bool = False,
+                          min_text_length: int = 100, output_dir: Optional[str] = None,
+                          min_pages: int = 0, allowed_hosts: Optional[List[str]] = None,
+                          denied_hosts: Optional[List[str]] = None, streaming: bool = False,
+                          language: str = 'auto', store_raw_text: bool = False,
+                          max_run_duration: Optional[float] = None, sample: Optional[float] = None,
+                          seed: Optional[int] = None, max_in_flight_bytes: Optional[int] = None):
     """Process announcements: download PDFs and extract data"""
+    run_id = db.start_run('extract')
+    processor = None
     try:
         # Get announcements
-        announcements = db.get_recent_announcements(dept_id, limit)
+        announcements = sample_announcements(db.get_recent_announcements(dept_id, limit), sample, seed)
         if not announcements:
             logging.info("No announcements found to process")
+            db.finish_run(run_id, {}, 'completed')
             return
         
-        # Download PDFs
-        logging.info(f"Downloading PDFs for {len(announcements)} announcements...")
-        download_results = download_pdfs(announcements)
+        # Download and extract each announcement
+        logging.info(f"Processing PDFs for {len(announcements)} announcements...")
+        extractor = PDFExtractor(engine=engine, min_text_length=min_text_length, streaming=streaming,
+                                 language=language, cache_dir=DEFAULT_CACHE_DIR)
+        processor = PDFProcessor(db, entry_timeout=entry_timeout, max_download_bytes=max_download_bytes,
+                                 force=force, extractor=extractor, output_dir=output_dir,
+                                 min_pages=min_pages, allowed_hosts=allowed_hosts,
+                                 denied_hosts=denied_hosts, store_raw_text=store_raw_text,
+                                 max_run_duration=max_run_duration, max_in_flight_bytes=max_in_flight_bytes)
+        results = asyncio.run(processor.process_batch(announcements))
+        success_count = sum(1 for success in results if success)
         
-        # Process downloaded PDFs
-        processor = PDFProcessor(db)
-        success_count = 0
-        
-        for result in download_results:
-            if not result['success']:
-                logging.warning(f"Skipping extraction for failed download: {result['project_id']}")
-                continue
-                
-            # Find corresponding announcement
-            announcement = next(
-                (a for a in announcements if a['project_id'] == result['project_id']), 
-                None
-            )
-            
-            if not announcement:
-                logging.warning(f"Could not find announcement for project {result['project_id']}")
-                continue
-            
-            # Process the PDF
-            success = processor.process_pdf_data(result['filepath'], announcement['id'])
-            if success:
-                success_count += 1
-        
-        logging.info(f"Processing completed. Successfully processed {success_count} of {len(download_results)} PDFs")
+        logging.info(f"Processing completed. Successfully processed {success_count} of {len(results)} PDFs")
+        db.finish_run(run_id, processor.stats, 'completed')
         
     except Exception as e:
         logging.error(f"Error in process_announcements: {e}")
+        db.finish_run(run_id, processor.stats if processor else {}, 'failed')
+        raise
+
+def reextract_announcements(db: Database, dept_id: Optional[str] = None, limit: int = 10,
+                            engine: str = 'pypdf2', min_text_length: int = 100,
+                            output_dir: Optional[str] = None, min_pages: int = 0,
+                            streaming: bool = False, language: str = 'auto',
+                            store_raw_text: bool = False, sample: Optional[float] = None,
+                            seed: Optional[int] = None):
+    """Re-extract data for announcements from their cached PDFs without downloading"""
+    run_id = db.start_run('reextract')
+    processor = None
+    try:
+        announcements = sample_announcements(db.get_recent_announcements(dept_id, limit), sample, seed)
+        if not announcements:
+            logging.info("No announcements found to re-extract")
+            db.finish_run(run_id, {}, 'completed')
+            return
+
+        logging.info(f"Re-extracting cached PDFs for {len(announcements)} announcements...")
+        extractor = PDFExtractor(engine=engine, min_text_length=min_text_length, streaming=streaming,
+                                 language=language, cache_dir=DEFAULT_CACHE_DIR)
+        processor = PDFProcessor(db, extractor=extractor, output_dir=output_dir, min_pages=min_pages,
+                                 store_raw_text=store_raw_text)
+        results = processor.reextract_batch(announcements)
+        success_count = sum(1 for success in results if success)
+
+        logging.info(f"Re-extraction completed. Refreshed {success_count} of {len(results)} cached PDFs, "
+                     f"skipped {processor.stats['skipped']} without a cached PDF")
+        db.finish_run(run_id, processor.stats, 'completed')
+
+    except Exception as e:
+        logging.error(f"Error in reextract_announcements: {e}")
+        db.finish_run(run_id, processor.stats if processor else {}, 'failed')
+        raise
+
+def reprocess_date_range(db: Database, start: datetime, end: datetime, dept_id: Optional[str] = None,
+                         entry_timeout: Optional[float] = 300, max_download_bytes: Optional[int] = None,
+                         engine: str = 'pypdf2', min_text_length: int = 100,
+                         output_dir: Optional[str] = None, min_pages: int = 0,
+                         language: str = 'auto', store_raw_text: bool = False,
+                         max_run_duration: Optional[float] = None, allowed_hosts: Optional[List[str]] = None,
+                         denied_hosts: Optional[List[str]] = None, streaming: bool = False,
+                         max_in_flight_bytes: Optional[int] = None):
+    """Download and extract again every announcement published from start up to (not including) end"""
+    run_id = db.start_run('reprocess')
+    processor = None
+    try:
+        announcements = db.get_announcements_by_date_range(start, end, dept_id)
+        if not announcements:
+            logging.info(f"No announcements published between {start} and {end}")
+            db.finish_run(run_id, {}, 'completed')
+            return
+
+        # Reset each announcement so extracted, filtered and dead-lettered entries all run again
+        logging.info(f"Reprocessing {len(announcements)} announcements published between {start} and {end}...")
+        for announcement in announcements:
+            db.requeue_dead_letter(announcement['id'])
+
+        extractor = PDFExtractor(engine=engine, min_text_length=min_text_length, streaming=streaming,
+                                 language=language, cache_dir=DEFAULT_CACHE_DIR)
+        processor = PDFProcessor(db, entry_timeout=entry_timeout, max_download_bytes=max_download_bytes,
+                                 force=True, extractor=extractor, output_dir=output_dir,
+                                 min_pages=min_pages, allowed_hosts=allowed_hosts,
+                                 denied_hosts=denied_hosts, store_raw_text=store_raw_text,
+                                 max_run_duration=max_run_duration, max_in_flight_bytes=max_in_flight_bytes)
+        results = asyncio.run(processor.process_batch(announcements))
+        success_count = sum(1 for success in results if success)
+
+        logging.info(f"Reprocessing completed. Successfully processed {success_count} of {len(results)} PDFs")
+        db.finish_run(run_id, processor.stats, 'completed')
+
+    except Exception as e:
+        logging.error(f"Error in reprocess_date_range: {e}")
+        db.finish_run(run_id, processor.stats if processor else {}, 'failed')
         raise
 
 if __name__ == "__main__":
@@ -0,0 +1,133 @@
+import re
+from typing import Dict, Optional
+
+NORTH = 'ภาคเหนือ'
+NORTHEAST = 'ภาคตะวันออกเฉียงเหนือ'
+CENTRAL = 'ภาคกลาง'
+EAST = 'ภาคตะวันออก'
+WEST = 'ภาคตะวันตก'
+SOUTH = 'ภาคใต้'
+
+# Thai name, English name, region and other spellings seen in documents
+PROVINCES = [
+    ('กรุงเทพมหานคร', 'Bangkok', CENTRAL, ('กรุงเทพฯ', 'กรุงเทพ', 'กทม.', 'กทม', 'Krung Thep')),
+    ('กระบี่', 'Krabi', SOUTH, ()),
+    ('กาญจนบุรี', 'Kanchanaburi', WEST, ()),
+    ('กาฬสินธุ์', 'Kalasin', NORTHEAST, ()),
+    ('กำแพงเพชร', 'Kamphaeng Phet', CENTRAL, ()),
+    ('ขอนแก่น', 'Khon Kaen', NORTHEAST, ()),
+    ('จันทบุรี', 'Chanthaburi', EAST, ('Chantaburi',)),
+    ('ฉะเชิงเทรา', 'Chachoengsao', EAST, ('แปดริ้ว',)),
+    ('ชลบุรี', 'Chonburi', EAST, ('Chon Buri',)),
+    ('ชัยนาท', 'Chai Nat', CENTRAL, ('Chainat',)),
+    ('ชัยภูมิ', 'Chaiyaphum', NORTHEAST, ()),
+    ('ชุมพร', 'Chumphon', SOUTH, ()),
+    ('เชียงราย', 'Chiang Rai', NORTH, ()),
+    ('เชียงใหม่', 'Chiang Mai', NORTH, ()),
+    ('ตรัง', 'Trang', SOUTH, ()),
+    ('ตราด', 'Trat', EAST, ()),
+    ('ตาก', 'Tak', WEST, ()),
+    ('นครนายก', 'Nakhon Nayok', CENTRAL, ()),
+    ('นครปฐม', 'Nakhon Pathom', CENTRAL, ()),
+    ('นครพนม', 'Nakhon Phanom', NORTHEAST, ()),
+    ('นครราชสีมา', 'Nakhon Ratchasima', NORTHEAST, ('โคราช', 'Korat')),
+    ('นครศรีธรรมราช', 'Nakhon Si Thammarat', SOUTH, ()),
+    ('นครสวรรค์', 'Nakhon Sawan', CENTRAL, ()),
+    ('นนทบุรี', 'Nonthaburi', CENTRAL, ()),
+    ('นราธิวาส', 'Narathiwat', SOUTH, ()),
+    ('น่าน', 'Nan', NORTH, ()),
+    ('บึงกาฬ', 'Bueng Kan', NORTHEAST, ('Bungkan',)),
+    ('บุรีรัมย์', 'Buriram', NORTHEAST, ('Buri Ram',)),
+    ('ปทุมธานี', 'Pathum Thani', CENTRAL, ()),
+    ('ประจวบคีรีขันธ์', 'Prachuap Khiri Khan', WEST, ()),
+    ('ปราจีนบุรี', 'Prachinburi', EAST, ('Prachin Buri',)),
+    ('ปัตตานี', 'Pattani', SOUTH, ()),
+    ('พระนครศรีอยุธยา', 'Phra Nakhon Si Ayutthaya', CENTRAL, ('อยุธยา', 'Ayutthaya')),
+    ('พะเยา', 'Phayao', NORTH, ()),
+    ('พังงา', 'Phang Nga', SOUTH, ('Phangnga',)),
+    ('พัทลุง', 'Phatthalung', SOUTH, ()),
+    ('พิจิตร', 'Phichit', CENTRAL, ()),
+    ('พิษณุโลก', 'Phitsanulok', CENTRAL, ()),
+    ('เพชรบุรี', 'Phetchaburi', WEST, ()),
+    ('เพชรบูรณ์', 'Phetchabun', CENTRAL, ()),
+    ('แพร่', 'Phrae', NORTH, ()),
+    ('ภูเก็ต', 'Phuket', SOUTH, ()),
+    ('มหาสารคาม', 'Maha Sarakham', NORTHEAST, ()),
+    ('มุกดาหาร', 'Mukdahan', NORTHEAST, ()),
+    ('แม่ฮ่องสอน', 'Mae Hong Son', NORTH, ()),
+    ('ยโสธร', 'Yasothon', NORTHEAST, ()),
+    ('ยะลา', 'Yala', SOUTH, ()),
+    ('ร้อยเอ็ด', 'Roi Et', NORTHEAST, ()),
+    ('ระนอง', 'Ranong', SOUTH, ()),
+    ('ระยอง', 'Rayong', EAST, ()),
+    ('ราชบุรี', 'Ratchaburi', WEST, ()),
+    ('ลพบุรี', 'Lopburi', CENTRAL, ('Lop Buri',)),
+    ('ลำปาง', 'Lampang', NORTH, ()),
+    ('ลำพูน', 'Lamphun', NORTH, ()),
+    ('เลย', 'Loei', NORTHEAST, ()),
+    ('ศรีสะเกษ', 'Sisaket', NORTHEAST, ('Si Sa Ket',)),
+    ('สกลนคร', 'Sakon Nakhon', NORTHEAST, ()),
+    ('สงขลา', 'Songkhla', SOUTH, ()),
+    ('สตูล', 'Satun', SOUTH, ()),
+    ('สมุทรปราการ', 'Samut Prakan', CENTRAL, ()),
+    ('สมุทรสงคราม', 'Samut Songkhram', CENTRAL, ()),
+    ('สมุทรสาคร', 'Samut Sakhon', CENTRAL, ()),
+    ('สระแก้ว', 'Sa Kaeo', EAST, ()),
+    ('สระบุรี', 'Saraburi', CENTRAL, ()),
+    ('สิงห์บุรี', 'Sing Buri', CENTRAL, ('Singburi',)),
+    ('สุโขทัย', 'Sukhothai', CENTRAL, ()),
+    ('สุพรรณบุรี', 'Suphan Buri', CENTRAL, ('Suphanburi',)),
+    ('สุราษฎร์ธานี', 'Surat Thani', SOUTH, ('สุราษฎร์ฯ',)),
+    ('สุรินทร์', 'Surin', NORTHEAST, ()),
+    ('หนองคาย', 'Nong Khai', NORTHEAST, ()),
+    ('หนองบัวลำภู', 'Nong Bua Lamphu', NORTHEAST, ()),
+    ('อ่างทอง', 'Ang Thong', CENTRAL, ()),
+    ('อำนาจเจริญ', 'Amnat Charoen', NORTHEAST, ()),
+    ('อุดรธานี', 'Udon Thani', NORTHEAST, ()),
+    ('อุตรดิตถ์', 'Uttaradit', NORTH, ()),
+    ('อุทัยธานี', 'Uthai Thani', CENTRAL, ()),
+    ('อุบลราชธานี', 'Ubon Ratchathani', NORTHEAST, ()),
+]
+
+# Names that are also everyday Thai words, only trusted after "จังหวัด" or "จ."
+REQUIRE_CUE = {'เลย', 'ตาก', 'น่าน', 'ตรัง', 'แพร่'}
+
+PROVINCE_CUE = r'(?:จังหวัด|จ\.)\s*'
+
+def _build_variants():
+    """List every spelling with its province, longest first so longer names win"""
+    variants = []
+    for thai, english, region, others in PROVINCES:
+        province = {'name': thai, 'name_en': english, 'region': region}
+        for spelling in (thai, english) + others:
+            variants.append((spelling, province))
+    return sorted(variants, key=lambda v: len(v[0]), reverse=True)
+
+VARIANTS = _build_variants()
+
+def classify_province(text: str) -> Optional[Dict[str, str]]:
+    """
+    Find the province an address or document refers to
+    Returns the Thai name, English name and region, or None when no province is found
+    """
+    if not text:
+        return None
+    flattened = ' '.join(text.split())
+
+    # An explicit "จังหวัด"/"จ." is the strongest signal, so it is tried first
+    for cued in (True, False):
+        best = None
+        for spelling, province in VARIANTS:
+            if not cued and spelling in REQUIRE_CUE:
+                continue
+            pattern = re.escape(spelling)
+            if spelling.isascii():
+                pattern = r'\b' + pattern + r'\b'
+            if cued:
+                pattern = PROVINCE_CUE + pattern
+            match = re.search(pattern, flattened, re.IGNORECASE)
+            if match and (best is None or match.start() < best[0]):
+                best = (match.start(), province)
+        if best:
+            return dict(best[1])
+    return None
@@ -0,0 +1,133 @@
+import io
+import logging
+import shutil
+import subprocess
+from typing import Iterator, List, Optional, Tuple
+import PyPDF2
+
+class PyPDF2Engine:
+    """Built-in text extraction using PyPDF2"""
+    name = 'pypdf2'
+
+    def is_available(self) -> bool:
+        return True
+
+    def extract_pages(self, data: bytes) -> List[Optional[str]]:
+        """Return the text of each page, or None for pages that could not be read"""
+        return list(self.open_pages(data)[1])
+
+    def open_pages(self, data: bytes) -> Tuple[int, Iterator[Optional[str]]]:
+        """Return the page count and an iterator that extracts each page's text only when reached"""
+        reader = PyPDF2.PdfReader(io.BytesIO(data))
+        return len(reader.pages), self.iter_pages(reader)
+
+    def iter_pages(self, reader) -> Iterator[Optional[str]]:
+        for i, page in enumerate(reader.pages):
+            try:
+                yield page.extract_text() or ''
+            except Exception as e:
+                logging.warning(f"Could not extract text from page {i+1}: {e}")
+                yield None
+
+class PyPDF2ColumnsEngine(PyPDF2Engine):
+    """
+    PyPDF2 extraction that reads two-column pages one column at a time
+    Pages without a clear second column use PyPDF2's plain text
+    """
+    name = 'pypdf2-columns'
+
+    def __init__(self, min_column_share: float = 0.2):
+        """
+        Args:
+            min_column_share: Fewest of a page's text fragments each half must start in for
+                the page to be read as two columns
+        """
+        self.min_column_share = min_column_share
+
+    def iter_pages(self, reader) -> Iterator[Optional[str]]:
+        for i, page in enumerate(reader.pages):
+            try:
+                yield self.column_text(page) or ''
+            except Exception as e:
+                logging.warning(f"Could not extract text from page {i+1}: {e}")
+                yield None
+
+    def column_text(self, page) -> Optional[str]:
+        """Get a page's text, with the left column of a two-column page before its right one"""
+        fragments = []
+
+        def visit(text, cm, tm, font_dict, font_size):
+            if text.strip():
+                # Text position on the page: the text matrix origin mapped through the current transform
+                x = tm[4] * cm[0] + tm[5] * cm[2] + cm[4]
+                y = tm[4] * cm[1] + tm[5] * cm[3] + cm[5]
+                fragments.append((x, y, text.strip('\n')))
+
+        # The visited pass also yields the plain text, kept for single-column pages
+        text = page.extract_text(visitor_text=visit)
+        if not fragments:
+            return text
+
+        middle = float(page.mediabox.width) / 2
+        left = [f for f in fragments if f[0] < middle]
+        right = [f for f in fragments if f[0] >= middle]
+        if min(len(left), len(right)) < self.min_column_share * len(fragments):
+            return text
+        return '\n'.join(self.column_lines(left) + self.column_lines(right))
+
+    def column_lines(self, fragments: List[Tuple[float, float, str]]) -> List[str]:
+        """Join a column's fragments into lines, top to bottom and left to right"""
+        lines = {}
+        for x, y, text in sorted(fragments, key=lambda f: (-round(f[1]), f[0])):
+            lines.setdefault(round(y), []).append(text)
+        return [''.join(texts) for texts in lines.values()]
+
+class PdftotextEngine:
+    """Text extraction using poppler's pdftotext, which handles Thai layouts better"""
+    name = 'pdftotext'
+
+    def __init__(self, executable: str = 'pdftotext', timeout: float = 120):
+        self.executable = executable
+        self.timeout = timeout
+
+    def is_available(self) -> bool:
+        return shutil.which(self.executable) is not None
+
+    def extract_pages(self, data: bytes) -> List[Optional[str]]:
+        """Return the text of each page"""
+        result = subprocess.run(
+            [self.executable, '-layout', '-enc', 'UTF-8', '-', '-'],
+            input=data,
+            capture_output=True,
+            timeout=self.timeout,
+            check=True
+        )
+        # pdftotext ends every page with a form feed
+        pages = result.stdout.decode('utf-8', errors='replace').split('\f')
+        if pages and not pages[-1].strip():
+            pages.pop()
+        return pages
+
+    def open_pages(self, data: bytes) -> Tuple[int, Iterator[Optional[str]]]:
+        """Return the page count and an iterator over each page's text"""
+        # pdftotext converts the whole document in one pass
+        pages = self.extract_pages(data)
+        return len(pages), iter(pages)
+
+ENGINES = {
+    PyPDF2Engine.name: PyPDF2Engine,
+    PyPDF2ColumnsEngine.name: PyPDF2ColumnsEngine,
+    PdftotextEngine.name: PdftotextEngine,
+}
+
+def get_engine(name: str = PyPDF2Engine.name):
+    """Create the named text engine, falling back to PyPDF2 when it is unavailable"""
+    engine_class = ENGINES.get(name)
+    if engine_class is None:
+        raise ValueError(f"Unknown text extraction engine: {name}")
+
+    engine = engine_class()
+    if not engine.is_available():
+        logging.warning(f"Text extraction engine '{name}' is not available, using {PyPDF2Engine.name}")
+        return PyPDF2Engine()
+    return engine
@@ -0,0 +1,88 @@
+import re
+from datetime import date
+from typing import Optional, Tuple
+
+# Thai calendar years are Buddhist era: 543 years ahead of the Gregorian year
+BUDDHIST_ERA_OFFSET = 543
+
+# Full and abbreviated Thai month names, with the month number
+THAI_MONTHS = {
+    'มกราคม': 1, 'ม.ค.': 1,
+    'กุมภาพันธ์': 2, 'ก.พ.': 2,
+    'มีนาคม': 3, 'มี.ค.': 3,
+    'เมษายน': 4, 'เม.ย.': 4,
+    'พฤษภาคม': 5, 'พ.ค.': 5,
+    'มิถุนายน': 6, 'มิ.ย.': 6,
+    'กรกฎาคม': 7, 'ก.ค.': 7,
+    'สิงหาคม': 8, 'ส.ค.': 8,
+    'กันยายน': 9, 'ก.ย.': 9,
+    'ตุลาคม': 10, 'ต.ค.': 10,
+    'พฤศจิกายน': 11, 'พ.ย.': 11,
+    'ธันวาคม': 12, 'ธ.ค.': 12,
+}
+
+THAI_DIGITS = str.maketrans('๐๑๒๓๔๕๖๗๘๙', '0123456789')
+
+# Abbreviations also appear without their dots ("มค"); longest names first so "มี.ค." is not read as "ม.ค."
+_MONTH_NAMES = sorted(set(THAI_MONTHS) | {name.replace('.', '') for name in THAI_MONTHS}, key=len, reverse=True)
+_MONTH = '|'.join(re.escape(name) for name in _MONTH_NAMES)
+_DAY = r'[\d๐-๙]{1,2}'
+_YEAR = r'(?:พ\.?\s*ศ\.?\s*)?([\d๐-๙]{4}|[\d๐-๙]{2})(?![\d๐-๙])'
+
+DATE_PATTERN = re.compile(rf'({_DAY})\s*({_MONTH})\s*{_YEAR}')
+
+# "1 มกราคม 2567 ถึงวันที่ 15 มกราคม 2567", "1 - 15 ม.ค. 67", "28 ธ.ค. - 5 ม.ค. 2567";
+# the start may leave out the month and year it shares with the end
+RANGE_PATTERN = re.compile(
+    rf'({_DAY})(?:\s*({_MONTH})(?:\s*{_YEAR})?)?\s*'
+    r'(?:(?:จน)?ถึง(?:\s*วันที่)?|[-–])\s*'
+    rf'({_DAY})\s*({_MONTH})\s*{_YEAR}'
+)
+
+def month_number(name: str) -> Optional[int]:
+    """Get the month number of a full or abbreviated Thai month name"""
+    name = name.strip()
+    return THAI_MONTHS.get(name) or next(
+        (number for month, number in THAI_MONTHS.items() if month.replace('.', '') == name), None)
+
+def gregorian_year(year: str) -> int:
+    """Convert a Buddhist-era year, in full or as its last two digits, to the Gregorian year"""
+    value = int(year.translate(THAI_DIGITS))
+    if value < 100:
+        value += 2500
+    return value - BUDDHIST_ERA_OFFSET if value > 2400 else value
+
+def build_date(day: str, month: str, year: str) -> Optional[date]:
+    """Build a date from matched Thai day, month name and year text"""
+    try:
+        return date(gregorian_year(year), month_number(month), int(day.translate(THAI_DIGITS)))
+    except (TypeError, ValueError):
+        return None
+
+def parse_thai_date(text: str) -> Optional[date]:
+    """Parse the first Thai date ("15 มกราคม 2567", "15 ม.ค. 67") in the text"""
+    match = DATE_PATTERN.search(text or '')
+    return build_date(*match.groups()) if match else None
+
+def parse_thai_date_range(text: str) -> Optional[Tuple[date, date]]:
+    """
+    Parse the first Thai date range in the text into its start and end dates
+    A start without its own month or year takes the end's
+    """
+    match = RANGE_PATTERN.search(' '.join((text or '').split()))
+    if not match:
+        return None
+    start_day, start_month, start_year, end_day, end_month, end_year = match.groups()
+
+    end = build_date(end_day, end_month, end_year)
+    start = build_date(start_day, start_month or end_month, start_year or end_year)
+    if not start or not end:
+        return None
+    # "28 ธ.ค. - 5 ม.ค. 2567" crosses into the year written after the end date
+    if start > end and start_month and not start_year:
+        start = build_date(start_day, start_month, str(start.year - 1))
+        if not start:
+            return None
+    if start > end:
+        return None
+    return start, end
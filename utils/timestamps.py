@@ -0,0 +1,64 @@
+import logging
+from datetime import datetime, timedelta, timezone, tzinfo
+from email.utils import parsedate_to_datetime
+from typing import Optional, Union
+
+# Thailand has no daylight saving, so a fixed offset needs no tz database
+BANGKOK = timezone(timedelta(hours=7), 'Asia/Bangkok')
+DISPLAY_TIMEZONE = BANGKOK
+
+# Same layout as SQLite's CURRENT_TIMESTAMP so stored times compare as text
+STORAGE_FORMAT = "%Y-%m-%d %H:%M:%S"
+# SQLite GLOB matching text already in STORAGE_FORMAT
+STORAGE_GLOB = '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]'
+DISPLAY_FORMAT = "%Y-%m-%d %H:%M:%S %z"
+
+# Database columns holding UTC timestamps
+TIMESTAMP_COLUMNS = ('published_date', 'created_at', 'updated_at', 'download_date', 'extracted_at',
+                     'started_at', 'finished_at', 'failed_at')
+
+def parse_timestamp(value: Union[str, datetime, None], assume_tz: tzinfo = timezone.utc) -> Optional[datetime]:
+    """
+    Parse an RFC 822 (feed) or ISO/SQLite timestamp into an aware datetime
+    Args:
+        value: Timestamp string or datetime
+        assume_tz: Time zone of values that carry no offset
+    Returns None when the value is empty or not a recognizable timestamp
+    """
+    if isinstance(value, datetime):
+        parsed = value
+    elif not value or not str(value).strip():
+        return None
+    else:
+        text = str(value).strip()
+        try:
+            parsed = datetime.fromisoformat(text)
+        except ValueError:
+            try:
+                parsed = parsedate_to_datetime(text)
+            except (TypeError, ValueError):
+                return None
+    if parsed.tzinfo is None:
+        parsed = parsed.replace(tzinfo=assume_tz)
+    return parsed
+
+def to_storage(value: Union[str, datetime, None], assume_tz: tzinfo = timezone.utc) -> Optional[str]:
+    """Convert a timestamp to the UTC text stored in the database, keeping unparseable values as they are"""
+    parsed = parse_timestamp(value, assume_tz)
+    if parsed is None:
+        if value:
+            logging.warning(f"Could not parse timestamp {value!r}, storing it unchanged")
+        return value or None
+    return parsed.astimezone(timezone.utc).strftime(STORAGE_FORMAT)
+
+def to_display(value: Union[str, datetime, None], tz: tzinfo = DISPLAY_TIMEZONE) -> Optional[datetime]:
+    """Convert a stored (UTC) timestamp to the display time zone"""
+    parsed = parse_timestamp(value)
+    return parsed.astimezone(tz) if parsed else None
+
+def format_display(value: Union[str, datetime, None], tz: tzinfo = DISPLAY_TIMEZONE, default: str = 'N/A') -> str:
+    """Format a stored (UTC) timestamp for display in the display time zone"""
+    if not value:
+        return default
+    local = to_display(value, tz)
+    return local.strftime(DISPLAY_FORMAT) if local else str(value)
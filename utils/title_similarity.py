@@ -0,0 +1,39 @@
+import re
+import unicodedata
+from difflib import SequenceMatcher
+
+THAI_DIGITS = str.maketrans('๐๑๒๓๔๕๖๗๘๙', '0123456789')
+
+def normalize_title(title: str) -> str:
+    """Normalize a Thai/English title for comparison"""
+    if not title:
+        return ''
+    text = unicodedata.normalize('NFC', title).translate(THAI_DIGITS).lower()
+    # Zero-width characters are common in copy-pasted Thai text
+    text = re.sub(r'[\u200b-\u200d\ufeff]', '', text)
+    # Strip punctuation and symbols; \w would also strip Thai vowel and tone marks
+    text = ''.join(' ' if unicodedata.category(c)[0] in 'PS' else c for c in text)
+    return ' '.join(text.split())
+
+def title_similarity(first: str, second: str) -> float:
+    """
+    Similarity between two titles, from 0.0 to 1.0
+    Uses a token-set comparison so word order does not matter, and a
+    whitespace-free comparison since Thai titles are spaced inconsistently.
+    """
+    first_normalized = normalize_title(first)
+    second_normalized = normalize_title(second)
+    if not first_normalized or not second_normalized:
+        return 0.0
+
+    first_tokens = set(first_normalized.split())
+    second_tokens = set(second_normalized.split())
+    common = sorted(first_tokens & second_tokens)
+    first_combined = ' '.join(common + sorted(first_tokens - second_tokens))
+    second_combined = ' '.join(common + sorted(second_tokens - first_tokens))
+    token_score = SequenceMatcher(None, first_combined, second_combined).ratio()
+
+    compact_score = SequenceMatcher(
+        None, first_normalized.replace(' ', ''), second_normalized.replace(' ', '')
+    ).ratio()
+    return max(token_score, compact_score)